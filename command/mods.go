@@ -0,0 +1,234 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/frantjc/valheimw/thunderstore"
+	"github.com/frantjc/valheimw/valheim"
+	"github.com/spf13/cobra"
+)
+
+// NewMods returns the command for browsing Thunderstore mods.
+func NewMods() *cobra.Command {
+	var (
+		offline   bool
+		community string
+		cmd       = &cobra.Command{
+			Use:   "mods",
+			Short: "Search and inspect Thunderstore mods",
+			PersistentPreRun: func(*cobra.Command, []string) {
+				thunderstore.DefaultClient = thunderstore.NewClient(
+					thunderstore.WithOffline(offline),
+					thunderstore.WithCommunity(community),
+				)
+			},
+		}
+	)
+
+	cmd.PersistentFlags().BoolVar(&offline, "offline", false, "Use only cached Thunderstore metadata")
+	cmd.PersistentFlags().StringVar(&community, "community", valheim.ThunderstoreCommunity, "Thunderstore community, e.g. lethal-company or riskofrain2")
+
+	cmd.AddCommand(newModsSearch(), newModsInfo(), newModsDeps())
+
+	return cmd
+}
+
+func newModsSearch() *cobra.Command {
+	var (
+		limit      int
+		searchOpts = &thunderstore.SearchOpts{}
+		cmd        = &cobra.Command{
+			Use:   "search [query]",
+			Short: "Search a Thunderstore community's mods",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if len(args) > 0 {
+					searchOpts.Query = args[0]
+				}
+
+				pkgs, err := thunderstore.DefaultClient.SearchPackages(cmd.Context(), "", searchOpts)
+				if err != nil {
+					return err
+				}
+
+				if limit > 0 && len(pkgs) > limit {
+					pkgs = pkgs[:limit]
+				}
+
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+				_, _ = fmt.Fprintln(tw, "PACKAGE\tVERSION\tDOWNLOADS\tRATING\tCATEGORIES")
+
+				for _, pkg := range pkgs {
+					_, _ = fmt.Fprintf(tw, "%s/%s\t%s\t%d\t%d\t%s\n",
+						pkg.Namespace, pkg.Name,
+						latestVersion(&pkg),
+						pkg.TotalDownloads,
+						pkg.RatingScore,
+						strings.Join(categories(&pkg), ", "),
+					)
+				}
+
+				return tw.Flush()
+			},
+		}
+	)
+
+	cmd.Flags().StringArrayVarP(&searchOpts.Categories, "category", "c", nil, "Only show mods in the category, e.g. Server-side or Client-side")
+	cmd.Flags().StringVar(&searchOpts.Sort, "sort", thunderstore.SortDownloads, fmt.Sprintf("Sort mods by one of %s", strings.Join(thunderstore.Sorts, ", ")))
+	cmd.Flags().BoolVar(&searchOpts.Deprecated, "deprecated", false, "Include deprecated mods")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 25, "Maximum number of mods to show (0 for all)")
+
+	return cmd
+}
+
+func newModsInfo() *cobra.Command {
+	return &cobra.Command{
+		Use:   "info <mod>",
+		Short: "Show a Thunderstore mod's metadata",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := thunderstore.ParsePackage(args[0])
+			if err != nil {
+				return err
+			}
+
+			// The latest version's metadata includes its community listings.
+			pkg, err := thunderstore.DefaultClient.GetPackage(cmd.Context(), &thunderstore.Package{Namespace: p.Namespace, Name: p.Name})
+			if err != nil {
+				return err
+			}
+
+			var (
+				dependencies = []string{}
+				tw           = tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			)
+
+			if pkg.Latest != nil {
+				dependencies = pkg.Latest.Dependencies
+			}
+
+			if p.VersionNumber != "" {
+				version, err := thunderstore.DefaultClient.GetPackage(cmd.Context(), p)
+				if err != nil {
+					return err
+				}
+
+				pkg.Latest = nil
+				pkg.VersionNumber = version.VersionNumber
+				pkg.Description = version.Description
+				pkg.DateCreated = version.DateCreated
+				dependencies = version.Dependencies
+			} else if pkg.Latest != nil {
+				pkg.Description = pkg.Latest.Description
+			}
+
+			_, _ = fmt.Fprintf(tw, "Package:\t%s/%s\n", pkg.Namespace, pkg.Name)
+			_, _ = fmt.Fprintf(tw, "Version:\t%s\n", latestVersion(pkg))
+			_, _ = fmt.Fprintf(tw, "Description:\t%s\n", pkg.Description)
+			_, _ = fmt.Fprintf(tw, "Categories:\t%s\n", strings.Join(categories(pkg), ", "))
+			_, _ = fmt.Fprintf(tw, "Downloads:\t%d\n", pkg.TotalDownloads)
+			_, _ = fmt.Fprintf(tw, "Rating:\t%d\n", pkg.RatingScore)
+			if pkg.PackageURL != nil && pkg.PackageURL.URL != nil {
+				_, _ = fmt.Fprintf(tw, "URL:\t%s\n", pkg.PackageURL)
+			}
+			if pkg.IsDeprecated {
+				_, _ = fmt.Fprintln(tw, "Deprecated:\ttrue")
+			}
+			_, _ = fmt.Fprintf(tw, "Dependencies:\t%s\n", strings.Join(dependencies, ", "))
+
+			return tw.Flush()
+		},
+	}
+}
+
+func newModsDeps() *cobra.Command {
+	return &cobra.Command{
+		Use:   "deps <mod>...",
+		Short: "Resolve and print Thunderstore mods' dependency tree",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgs, err := thunderstore.DependencyTree(cmd.Context(), args...)
+			if err != nil {
+				return err
+			}
+
+			resolved := map[string]*thunderstore.Package{}
+			for i := range pkgs {
+				resolved[pkgs[i].Versionless()] = &pkgs[i]
+			}
+
+			for _, arg := range args {
+				p, err := thunderstore.ParsePackage(arg)
+				if err != nil {
+					return err
+				}
+
+				if pkg, ok := resolved[p.Versionless()]; ok {
+					printDependencyTree(cmd.OutOrStdout(), resolved, pkg, "", "", map[string]bool{})
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// printDependencyTree prints pkg and then, indented beneath
+// it, the versions that its dependencies resolved to.
+func printDependencyTree(w io.Writer, resolved map[string]*thunderstore.Package, pkg *thunderstore.Package, prefix, childPrefix string, ancestors map[string]bool) {
+	_, _ = fmt.Fprintf(w, "%s%s-%s\n", prefix, pkg.Versionless(), latestVersion(pkg))
+
+	ancestors[pkg.Versionless()] = true
+	defer delete(ancestors, pkg.Versionless())
+
+	dependencies := pkg.Dependencies
+	if pkg.Latest != nil {
+		dependencies = pkg.Latest.Dependencies
+	}
+
+	for i, dependency := range dependencies {
+		dep, err := thunderstore.ParsePackageFullname(dependency)
+		if err != nil {
+			continue
+		}
+
+		branch, indent := "├── ", "│   "
+		if i == len(dependencies)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		depPkg, ok := resolved[dep.Versionless()]
+		if !ok || ancestors[dep.Versionless()] {
+			_, _ = fmt.Fprintf(w, "%s%s%s\n", childPrefix, branch, dependency)
+			continue
+		}
+
+		printDependencyTree(w, resolved, depPkg, childPrefix+branch, childPrefix+indent, ancestors)
+	}
+}
+
+func latestVersion(pkg *thunderstore.Package) string {
+	if pkg.VersionNumber == "" && pkg.Latest != nil {
+		return pkg.Latest.VersionNumber
+	}
+
+	return pkg.VersionNumber
+}
+
+func categories(pkg *thunderstore.Package) []string {
+	categories := []string{}
+
+	for _, communityListing := range pkg.CommunityListings {
+		for _, category := range communityListing.Categories {
+			if !slices.Contains(categories, category) {
+				categories = append(categories, category)
+			}
+		}
+	}
+
+	return categories
+}
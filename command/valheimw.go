@@ -2,25 +2,40 @@ package command
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"cmp"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/frantjc/go-ingress"
 	"github.com/frantjc/valheimw"
+	"github.com/frantjc/valheimw/internal/auth"
+	"github.com/frantjc/valheimw/internal/backup"
+	"github.com/frantjc/valheimw/internal/bundle"
 	"github.com/frantjc/valheimw/internal/cache"
+	"github.com/frantjc/valheimw/internal/lock"
 	"github.com/frantjc/valheimw/internal/logutil"
+	"github.com/frantjc/valheimw/internal/metrics"
+	"github.com/frantjc/valheimw/internal/notify"
 	"github.com/frantjc/valheimw/steamapp"
 	"github.com/frantjc/valheimw/thunderstore"
 	"github.com/frantjc/valheimw/valheim"
@@ -29,11 +44,19 @@ import (
 	"github.com/mmatczuk/anyflag"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
-	bepInExNamespace = "denikson"
-	bepInExName      = "BepInExPack_Valheim"
+	defaultMapSize = 1024
+	maxMapSize     = 2048
+	mapTileSize    = 256
+	// maxWorldsRestoreSize is the most that a world
+	// being restored can be, compressed or not.
+	maxWorldsRestoreSize = 1 << 30
+	// notifyShutdownTimeout is how long to keep posting the webhook
+	// events that are left after the Valheim server exits.
+	notifyShutdownTimeout = 30 * time.Second
 )
 
 func NewValheimw() *cobra.Command {
@@ -49,8 +72,29 @@ func NewValheimw() *cobra.Command {
 			Password: os.Getenv("VALHEIM_PASSWORD"),
 		}
 		valheimMapWorldVersion string
+		snapshotInterval       time.Duration
+		snapshotTarget         string
+		adminUsername          string
+		adminPassword          string
+		authenticator          = &auth.Authenticator{}
+		noRestart              bool
+		noShutdownSnapshot     bool
+		updateInterval         time.Duration
+		updateLock             bool
+		offline                bool
+		modProfile             string
+		modBundleExcludeConfig []string
+		updateMaxDelay         time.Duration
+		shutdownTimeout        time.Duration
+		restartPolicy          = valheim.DefaultRestartPolicy
+		webhooks               []string
+		discordWebhooks        []string
+		snapshotter            = &backup.Snapshotter{}
 		cmd                    = &cobra.Command{
 			Use: "valheimw",
+			// Mods is a subcommand, so keep accepting the arbitrary args that
+			// valheimw accepted before it had any.
+			Args: cobra.ArbitraryArgs,
 			RunE: func(cmd *cobra.Command, _ []string) error {
 				wd := filepath.Join(cache.Dir, "valheimw")
 				defer os.RemoveAll(wd)
@@ -65,122 +109,491 @@ func NewValheimw() *cobra.Command {
 					modded = len(mods) > 0
 				)
 
-				pkgs, err := thunderstore.DependencyTree(ctx, mods...)
+				thunderstore.DefaultClient = thunderstore.NewClient(
+					thunderstore.WithObserver(metrics.ThunderstoreObserver),
+					thunderstore.WithOffline(offline),
+					thunderstore.WithCommunity(valheim.ThunderstoreCommunity),
+				)
+
+				var profile *thunderstore.Profile
+				if modProfile != "" {
+					var err error
+					if profile, err = thunderstore.DefaultClient.OpenProfile(ctx, modProfile); err != nil {
+						return fmt.Errorf("opening mod profile: %w", err)
+					}
+
+					pkgNames, err := profile.PackageNames()
+					if err != nil {
+						return fmt.Errorf("reading mod profile %s: %w", profile.Name, err)
+					}
+
+					log.Info("using mod profile", "name", profile.Name, "mods", len(pkgNames))
+
+					mods = append(mods, pkgNames...)
+					modded = len(mods) > 0
+				}
+
+				// Finish restoring a world if valheimw
+				// exited partway through doing so.
+				if err := valheim.CompleteWorldInstall(opts.SaveDir, opts.World); err != nil {
+					return fmt.Errorf("completing world install: %w", err)
+				}
+
+				lockfile, err := lock.Read(opts.SaveDir)
 				if err != nil {
 					return err
 				}
 
+				// Whether or not to install exactly what is in the lockfile.
+				locked := !updateLock && lockfile != nil && lockfile.Applies(mods)
+
+				var pkgs []thunderstore.Package
+				if locked {
+					log.Info("using locked mods", "lockfile", filepath.Join(opts.SaveDir, lock.Filename))
+
+					pkgs = lockfile.ThunderstorePackages()
+				} else {
+					if lockfile != nil && !updateLock {
+						log.Info("mods changed since the lockfile was written: resolving them again")
+					}
+
+					if pkgs, err = thunderstore.DependencyTree(ctx, mods...); err != nil {
+						return err
+					}
+				}
+
+				var (
+					logs          = &valheim.LogParser{}
+					server        *valheim.Server
+					install       = func(context.Context) error { return nil }
+					restoreConfig = func() {}
+					// installMu serializes installs, which the updater can
+					// start, along with locked and restoreConfig, which they set.
+					installMu sync.Mutex
+					// modBundle is the client mod bundle, which
+					// gets rebuilt when it is next requested after
+					// each install in case the mods or config changed.
+					modBundle   *bundle.Bundle
+					modBundleMu sync.Mutex
+					// modBundleGeneration counts installs so that a
+					// bundle built before the latest one is not kept.
+					modBundleGeneration int
+					// modProfileCode is the code that modBundle's
+					// profile was shared via, once it is requested.
+					modProfileCode string
+				)
+
 				if !noValheim {
-					eg, installCtx := errgroup.WithContext(ctx)
+					server = &valheim.Server{
+						Dir:   wd,
+						Opts:  opts,
+						Stdin: cmd.InOrStdin(),
+						Logs:  logs,
+
+						ShutdownTimeout: shutdownTimeout,
+					}
+
+					if !noRestart {
+						server.RestartPolicy = &restartPolicy
+					}
+
+					// Package URLs to extract, keyed by the directory
+					// relative to wd that they get extracted to.
+					extractions := map[string]string{}
 
 					if modded {
 						log.Info("resolving dependency tree")
 
 						for _, pkg := range pkgs {
 							dir := fmt.Sprintf("BepInEx/plugins/%s", pkg.String())
-							isBepInEx := pkg.Namespace == bepInExNamespace && pkg.Name == bepInExName
+							isBepInEx := thunderstore.DefaultClient.IsBepInExPack(&pkg)
 
 							if isBepInEx {
 								opts.BepInEx = true
 								dir = "."
+							} else if pkg.IsModpack() {
+								// Modpacks only bundle config, which gets installed separately.
+								continue
 							} else if !xslices.Some(pkg.CommunityListings, func(communityListing thunderstore.CommunityListing, _ int) bool {
 								return slices.Contains(communityListing.Categories, "Server-side")
 							}) {
 								continue
 							}
 
-							log.Info("installing package", "pkg", pkg.String(), "rel", dir)
-
-							eg.Go(func() error {
-								return valheimw.Extract(installCtx,
-									fmt.Sprintf("%s://%s", thunderstore.Scheme, pkg.String()),
-									filepath.Join(wd, dir),
-								)
-							})
+							extractions[dir] = fmt.Sprintf("%s://%s", thunderstore.Scheme, pkg.String())
 						}
 
 						if !opts.BepInEx {
 							opts.BepInEx = true
 
-							pkg, err := thunderstore.NewClient().GetPackage(ctx, &thunderstore.Package{
-								Namespace: bepInExNamespace,
-								Name:      bepInExName,
-							})
+							bepInExPack, err := thunderstore.DefaultClient.BepInExPack()
+							if err != nil {
+								return err
+							}
+
+							pkg, err := thunderstore.DefaultClient.GetPackage(ctx, bepInExPack)
 							if err != nil {
 								return err
 							}
 
 							pkgs = append(pkgs, *pkg)
 
-							log.Info("installing latest BepInEx: no mods depended on a specific version", "pkg", pkg.String())
+							log.Info("using latest BepInEx: no mods depended on a specific version", "pkg", pkg.String())
+
+							extractions["."] = fmt.Sprintf("%s://%s", thunderstore.Scheme, pkg.String())
+						}
+					}
+
+					// lockPackages downloads and checksums each package. Packages from the
+					// lockfile carry their checksum, so the client verifies them against it.
+					lockPackages := func(ctx context.Context) ([]lock.Package, error) {
+						var (
+							eg, lockCtx = errgroup.WithContext(ctx)
+							lockedPkgs  = make([]lock.Package, len(pkgs))
+						)
 
+						for i, pkg := range pkgs {
 							eg.Go(func() error {
-								return valheimw.Extract(installCtx,
-									fmt.Sprintf("%s://%s", thunderstore.Scheme, pkg.String()),
-									wd,
-								)
+								pkgZip, err := thunderstore.DefaultClient.GetPackageZip(lockCtx, &pkg)
+								if err != nil {
+									return err
+								}
+								defer pkgZip.Close()
+
+								sha256, err := pkgZip.SHA256()
+								if err != nil {
+									return err
+								}
+
+								lockedPkgs[i] = lock.NewPackage(&pkg, sha256)
+
+								return nil
 							})
 						}
+
+						return lockedPkgs, eg.Wait()
 					}
 
-					log.Info("installing Valheim server")
+					// checkLockedBuild errors if the given build of the Valheim server is not the locked one.
+					// The Valheim server is installed via steamcmd's app_update, which only installs the
+					// latest build of a branch, so rather than run a build other than the locked one,
+					// valheimw refuses to until the lockfile is explicitly updated to it.
+					checkLockedBuild := func(buildID int) error {
+						if err := lockfile.CheckValheimBuild(buildID); err != nil {
+							return fmt.Errorf("%w: run with --update-lock to accept it", err)
+						}
 
-					eg.Go(func() error {
-						return valheimw.Extract(installCtx,
-							fmt.Sprintf("%s://%d?%s", steamapp.Scheme, valheim.SteamappID, steamapp.URLValues(openOpts).Encode()),
-							wd,
-						)
-					})
+						return nil
+					}
 
-					if err := eg.Wait(); err != nil {
-						return fmt.Errorf("installing game files: %w", err)
+					// writeLockfile writes a new lockfile unless the existing one is being honored,
+					// in which case it errors if the installed Valheim server build does not match it.
+					writeLockfile := func(lockedPkgs []lock.Package) error {
+						appManifest, err := steamapp.ReadAppManifest(wd, valheim.SteamappID)
+						if err != nil {
+							return fmt.Errorf("reading Valheim server app manifest: %w", err)
+						}
+
+						if locked {
+							return checkLockedBuild(appManifest.BuildID)
+						}
+
+						log.Info("writing lockfile", "lockfile", filepath.Join(opts.SaveDir, lock.Filename))
+
+						return lock.Write(opts.SaveDir, &lock.Lockfile{
+							Mods:     mods,
+							Valheim:  appManifest,
+							Packages: lockedPkgs,
+						})
 					}
 
-					log.Info("finished installing")
+					install = func(ctx context.Context) error {
+						// Check before downloading anything that the locked build is
+						// still the one that would be installed. The lockfile is
+						// checked again once it is installed in case it changed since.
+						if locked {
+							buildID, err := steamapp.BuildID(ctx, valheim.SteamappID, openOpts)
+							if err != nil {
+								return fmt.Errorf("getting latest Valheim server build: %w", err)
+							}
+
+							if err := checkLockedBuild(buildID); err != nil {
+								return err
+							}
+						}
 
-					if modded {
-						var (
-							saveCfgDir    = filepath.Join(opts.SaveDir, "config")
-							bepInExCfgDir = filepath.Join(wd, "BepInEx/config")
-						)
+						lockedPkgs, err := lockPackages(ctx)
+						if err != nil {
+							return fmt.Errorf("locking packages: %w", err)
+						}
 
-						if err := os.MkdirAll(saveCfgDir, 0775); err != nil {
-							return err
+						eg, installCtx := errgroup.WithContext(ctx)
+
+						for dir, u := range extractions {
+							log.Info("installing package", "url", u, "rel", dir)
+
+							eg.Go(func() error {
+								defer metrics.ObserveInstall(u, time.Now())
+
+								return valheimw.Extract(installCtx, u, filepath.Join(wd, dir))
+							})
 						}
 
-						if err := xtar.Extract(
-							tar.NewReader(xtar.Compress(saveCfgDir)),
-							bepInExCfgDir,
-						); err != nil {
+						log.Info("installing Valheim server")
+
+						eg.Go(func() error {
+							defer metrics.ObserveInstall("valheim", time.Now())
+
+							return valheimw.Extract(installCtx,
+								fmt.Sprintf("%s://%d?%s", steamapp.Scheme, valheim.SteamappID, steamapp.URLValues(openOpts).Encode()),
+								wd,
+							)
+						})
+
+						if err := eg.Wait(); err != nil {
+							return fmt.Errorf("installing game files: %w", err)
+						}
+
+						log.Info("finished installing")
+
+						if err := writeLockfile(lockedPkgs); err != nil {
 							return err
 						}
 
-						defer func() {
-							_ = xtar.Extract(
-								tar.NewReader(xtar.Compress(bepInExCfgDir)),
-								saveCfgDir,
+						if modded {
+							var (
+								saveCfgDir    = filepath.Join(opts.SaveDir, "config")
+								bepInExCfgDir = filepath.Join(wd, "BepInEx/config")
 							)
-						}()
-					}
 
-					if err := valheim.WritePlayerLists(opts.SaveDir, playerLists); err != nil {
-						return fmt.Errorf("writing player lists: %w", err)
+							if err := os.MkdirAll(saveCfgDir, 0775); err != nil {
+								return err
+							}
+
+							if err := xtar.Extract(
+								tar.NewReader(xtar.Compress(saveCfgDir)),
+								bepInExCfgDir,
+							); err != nil {
+								return err
+							}
+
+							restoreConfig = func() {
+								_ = xtar.Extract(
+									tar.NewReader(xtar.Compress(bepInExCfgDir)),
+									saveCfgDir,
+								)
+							}
+
+							// Config bundled with modpacks and then the mod
+							// profile takes precedence over the savedir's.
+							profiles := []*thunderstore.Profile{}
+							for _, pkg := range pkgs {
+								if pkg.IsModpack() {
+									modpack, err := thunderstore.DefaultClient.GetModpackProfile(ctx, &pkg)
+									if err != nil {
+										return fmt.Errorf("getting modpack %s config: %w", pkg.String(), err)
+									}
+
+									profiles = append(profiles, modpack)
+								}
+							}
+
+							if profile != nil {
+								profiles = append(profiles, profile)
+							}
+
+							for _, p := range profiles {
+								if len(p.Config) > 0 {
+									log.Info("restoring bundled config", "profile", p.Name, "files", len(p.Config))
+
+									if err := p.WriteConfig(bepInExCfgDir); err != nil {
+										return fmt.Errorf("writing %s config: %w", p.Name, err)
+									}
+								}
+							}
+						}
+
+						if err := valheim.WritePlayerLists(opts.SaveDir, playerLists); err != nil {
+							return fmt.Errorf("writing player lists: %w", err)
+						}
+
+						modBundleMu.Lock()
+						modBundle = nil
+						modBundleGeneration++
+						modBundleMu.Unlock()
+
+						return nil
 					}
 				}
 
+				if snapshotTarget == "" {
+					snapshotTarget = filepath.Join(opts.SaveDir, "snapshots")
+				}
+
+				snapshotter.SaveDir = opts.SaveDir
+				if snapshotter.Target, err = backup.OpenTarget(ctx, snapshotTarget); err != nil {
+					return fmt.Errorf("opening snapshot target: %w", err)
+				}
+
 				log.Info("configuring HTTP server")
 
+				if len(authenticator.Tokens) == 0 {
+					authenticator.Tokens = strings.Fields(os.Getenv("VALHEIMW_ADMIN_TOKEN"))
+				}
+
+				if adminPassword == "" {
+					adminPassword = os.Getenv("VALHEIMW_ADMIN_PASSWORD")
+				}
+
+				if adminUsername != "" && adminPassword != "" {
+					authenticator.Users = map[string]string{adminUsername: adminPassword}
+				}
+
+				if !authenticator.Enabled() {
+					log.Warn("admin endpoints, e.g. /worlds and /backups, deny every request: set --admin-token or --admin-password to enable them")
+				}
+
+				admin := func(h http.Handler) http.Handler {
+					return authenticator.Handler(auth.ScopeAdmin, h)
+				}
+
 				var (
-					zHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-						_, _ = w.Write([]byte("ok\n"))
+					exactPath = func(route string, h http.Handler, opts ...ingress.ExactPathOpt) ingress.Path {
+						return ingress.ExactPath(route, metrics.InstrumentHandler(route, h), opts...)
+					}
+					prefixPath = func(route string, h http.Handler) ingress.Path {
+						return ingress.PrefixPath(route, metrics.InstrumentHandler(path.Join(route, "*"), h))
+					}
+				)
+
+				var (
+					status = func() *valheim.Status {
+						if server == nil {
+							return &valheim.Status{Phase: valheim.PhaseStopped, Live: true, Ready: true}
+						}
+
+						return server.Status()
+					}
+					probeHandler = func(probe func(*valheim.Status) bool) http.Handler {
+						return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+							if !probe(status()) {
+								w.WriteHeader(http.StatusServiceUnavailable)
+								_, _ = w.Write([]byte("not ok\n"))
+								return
+							}
+
+							_, _ = w.Write([]byte("ok\n"))
+						})
+					}
+					healthzHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+						s := status()
+
+						w.Header().Add("Content-Type", "application/json")
+						if !s.Live || s.Degraded {
+							w.WriteHeader(http.StatusServiceUnavailable)
+						}
+
+						_ = json.NewEncoder(w).Encode(s)
 					})
 					paths = []ingress.Path{
-						ingress.ExactPath("/readyz", zHandler),
-						ingress.ExactPath("/livez", zHandler),
-						ingress.ExactPath("/healthz", zHandler),
+						exactPath("/readyz", probeHandler(func(s *valheim.Status) bool { return s.Ready })),
+						exactPath("/livez", probeHandler(func(s *valheim.Status) bool { return s.Live })),
+						exactPath("/healthz", healthzHandler),
+						exactPath("/metrics", metrics.Handler()),
+					}
+				)
+
+				var (
+					roster  = valheim.NewRoster(opts.SaveDir)
+					updater = &valheim.Updater{
+						Server: server,
+						Roster: roster,
+						Installed: func() (int, error) {
+							return steamapp.InstalledBuildID(wd, valheim.SteamappID)
+						},
+						Latest: func(ctx context.Context) (int, error) {
+							return steamapp.BuildID(ctx, valheim.SteamappID, openOpts)
+						},
+						Update: func(ctx context.Context) error {
+							installMu.Lock()
+							defer installMu.Unlock()
+
+							// The update is intentional, so record
+							// the new build in the lockfile.
+							locked = false
+							// Keep any changes made to the BepInEx config
+							// since it was installed before reinstalling.
+							restoreConfig()
+							return install(ctx)
+						},
+						Interval: updateInterval,
+						MaxDelay: updateMaxDelay,
 					}
 				)
 
+				if server != nil {
+					log.Info("exposing player-related endpoints")
+
+					var (
+						playersHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+							w.Header().Add("Content-Type", "application/json")
+
+							_ = json.NewEncoder(w).Encode(roster.Players())
+						})
+						playersHistoryHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							limit := 100
+							if l := r.URL.Query().Get("limit"); l != "" {
+								var err error
+								if limit, err = strconv.Atoi(l); err != nil {
+									http.Error(w, err.Error(), http.StatusBadRequest)
+									return
+								}
+							}
+
+							sessions, err := roster.History(limit)
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+
+							w.Header().Add("Content-Type", "application/json")
+
+							_ = json.NewEncoder(w).Encode(sessions)
+						})
+					)
+
+					versionHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+						w.Header().Add("Content-Type", "application/json")
+
+						_ = json.NewEncoder(w).Encode(updater.Version())
+					})
+
+					restartHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if r.Method != http.MethodPost {
+							w.Header().Set("Allow", http.MethodPost)
+							w.WriteHeader(http.StatusMethodNotAllowed)
+							return
+						}
+
+						log.Info("restarting Valheim server")
+
+						if err := server.Restart(r.Context()); err != nil {
+							http.Error(w, err.Error(), http.StatusInternalServerError)
+							return
+						}
+
+						w.WriteHeader(http.StatusAccepted)
+					})
+
+					paths = append(paths,
+						exactPath("/restart", admin(restartHandler)),
+						exactPath("/version", versionHandler),
+						exactPath("/players", playersHandler, ingress.WithMatchIgnoreSlash),
+						exactPath("/players.json", playersHandler),
+						exactPath("/players/history", playersHistoryHandler, ingress.WithMatchIgnoreSlash),
+					)
+				}
+
 				if !noDB {
 					log.Info("exposing .db-related endpoints")
 
@@ -197,30 +610,33 @@ func NewValheimw() *cobra.Command {
 
 							_, _ = io.Copy(w, db)
 						})
+						progressHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+							worldDB, err := valheim.ReadWorldDB(opts.SaveDir, opts.World, valheim.WithoutZDOs)
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+
+							w.Header().Add("Content-Type", "application/json")
+
+							_ = json.NewEncoder(w).Encode(worldDB.Progress())
+						})
 					)
 
 					paths = append(paths,
-						ingress.ExactPath("/world.db", dbHandler),
-						ingress.ExactPath(path.Join("/", fmt.Sprintf("%s.db", opts.World)), dbHandler),
+						exactPath("/progress", progressHandler),
+						exactPath("/progress.json", progressHandler),
+						exactPath("/world.db", admin(dbHandler)),
+						exactPath(path.Join("/", fmt.Sprintf("%s.db", opts.World)), admin(dbHandler)),
 					)
 				}
 
 				if !noFWL {
 					log.Info("exposing .fwl-related endpoints")
 
-					valheimMapURL, err := url.Parse(
-						fmt.Sprintf(
-							"https://valheim-map.world?offset=0,0&zoom=0.600&view=0&ver=%s",
-							valheimMapWorldVersion,
-						),
-					)
-					if err != nil {
-						return err
-					}
-
 					var (
 						seedJSONHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-							seed, err := valheim.ReadWorldSeed(opts.SaveDir, opts.World)
+							worldMetadata, err := valheim.ReadWorldMetadata(opts.SaveDir, opts.World)
 							if err != nil {
 								http.Error(w, err.Error(), http.StatusInternalServerError)
 								return
@@ -228,7 +644,13 @@ func NewValheimw() *cobra.Command {
 
 							w.Header().Add("Content-Type", "application/json")
 
-							_, _ = w.Write([]byte(fmt.Sprintf(`{"seed":"%s"}`, seed)))
+							_ = json.NewEncoder(w).Encode(&struct {
+								Seed string `json:"seed"`
+								*valheim.WorldMetadata
+							}{
+								Seed:          worldMetadata.SeedName,
+								WorldMetadata: worldMetadata,
+							})
 						})
 						seedTxtHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 							seed, err := valheim.ReadWorldSeed(opts.SaveDir, opts.World)
@@ -237,102 +659,365 @@ func NewValheimw() *cobra.Command {
 								return
 							}
 
-							w.Header().Add("Content-Type", "text/plain")
-
-							_, _ = w.Write([]byte(seed))
-						})
-						seedHdrHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-							if accept := r.Header.Get("Accept"); strings.Contains(accept, "application/json") {
-								seedJSONHandler(w, r)
+							w.Header().Add("Content-Type", "text/plain")
+
+							_, _ = w.Write([]byte(seed))
+						})
+						seedHdrHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							if accept := r.Header.Get("Accept"); strings.Contains(accept, "application/json") {
+								seedJSONHandler(w, r)
+								return
+							}
+
+							seedTxtHandler(w, r)
+						})
+						mapRenders singleflight.Group
+						// renderMap renders the given area of the world to a PNG in wd, unless
+						// it already has been. Biomes only depend on the seed, so renders are
+						// cached by it and concurrent requests for the same one share a render.
+						renderMap = func(worldMetadata *valheim.WorldMetadata, name string, rect valheim.MapRect, size int) (string, error) {
+							mapPath := filepath.Join(wd, "maps", fmt.Sprintf("%d-%d", worldMetadata.SeedHash, worldMetadata.WorldGenVersion), name)
+
+							if _, err := os.Stat(mapPath); err == nil {
+								return mapPath, nil
+							}
+
+							_, err, _ := mapRenders.Do(mapPath, func() (any, error) {
+								if _, err := os.Stat(mapPath); err == nil {
+									return nil, nil
+								}
+
+								if err := os.MkdirAll(filepath.Dir(mapPath), 0755); err != nil {
+									return nil, err
+								}
+
+								f, err := os.CreateTemp(filepath.Dir(mapPath), ".map-*")
+								if err != nil {
+									return nil, err
+								}
+								defer os.Remove(f.Name())
+								defer f.Close()
+
+								if err := png.Encode(f, valheim.NewWorldGenerator(worldMetadata).RenderMap(rect, size)); err != nil {
+									return nil, err
+								}
+
+								if err := f.Close(); err != nil {
+									return nil, err
+								}
+
+								return nil, os.Rename(f.Name(), mapPath)
+							})
+
+							return mapPath, err
+						}
+						writeMap = func(w http.ResponseWriter, r *http.Request, name string, rect valheim.MapRect, size int) {
+							worldMetadata, err := valheim.ReadWorldMetadata(opts.SaveDir, opts.World)
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+
+							mapPath, err := renderMap(worldMetadata, name, rect, size)
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+
+							f, err := os.Open(mapPath)
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+							defer f.Close()
+
+							overlays := r.URL.Query()["overlay"]
+							if len(overlays) == 0 {
+								fi, err := f.Stat()
+								if err != nil {
+									http.Error(w, err.Error(), http.StatusInternalServerError)
+									return
+								}
+
+								http.ServeContent(w, r, mapPath, fi.ModTime(), f)
+								return
+							}
+
+							if noDB {
+								http.Error(w, "map overlays require the world .db", http.StatusBadRequest)
+								return
+							}
+
+							src, err := png.Decode(f)
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+
+							var (
+								img        = image.NewRGBA(src.Bounds())
+								structures = slices.Contains(overlays, "structures")
+								locations  = slices.Contains(overlays, "locations")
+							)
+
+							draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+
+							worldDB, err := valheim.ReadWorldDB(opts.SaveDir, opts.World, valheim.WithZDOFilter(func(zdo *valheim.ZDO) bool {
+								_, ok := zdo.Creator()
+								return structures && ok
+							}))
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+
+							if structures {
+								valheim.DrawMarkers(img, rect, valheim.MarkerColor, xslices.Map(worldDB.ZDOs, func(zdo valheim.ZDO, _ int) valheim.Vector3 {
+									return zdo.Position
+								})...)
+							}
+
+							if locations {
+								valheim.DrawMarkers(img, rect, color.White, xslices.Map(worldDB.Locations, func(location valheim.Location, _ int) valheim.Vector3 {
+									return location.Position
+								})...)
+							}
+
+							w.Header().Add("Content-Type", "image/png")
+
+							_ = png.Encode(w, img)
+						}
+						// adminOverlays only lets admins request a map with overlays,
+						// since they reveal where players have built their bases.
+						adminOverlays = func(h http.Handler) http.Handler {
+							adminH := admin(h)
+
+							return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+								if r.URL.Query().Has("overlay") {
+									adminH.ServeHTTP(w, r)
+									return
+								}
+
+								h.ServeHTTP(w, r)
+							})
+						}
+						mapHandler = adminOverlays(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							size := defaultMapSize
+							if s := r.URL.Query().Get("size"); s != "" {
+								var err error
+								if size, err = strconv.Atoi(s); err != nil || size < 1 || size > maxMapSize {
+									http.Error(w, fmt.Sprintf("size must be an integer between 1 and %d", maxMapSize), http.StatusBadRequest)
+									return
+								}
+							}
+
+							writeMap(w, r, fmt.Sprintf("%d.png", size), valheim.WorldMapRect, size)
+						}))
+						mapTileHandler = adminOverlays(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							z, x, y, err := valheim.ParseMapTile(strings.TrimPrefix(r.URL.Path, "/map/tiles/"))
+							if err != nil {
+								http.NotFound(w, r)
+								return
+							}
+
+							writeMap(w, r, filepath.Join("tiles", fmt.Sprint(z), fmt.Sprint(x), fmt.Sprintf("%d.png", y)), valheim.MapTileRect(z, x, y), mapTileSize)
+						}))
+						fwlHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+							w.Header().Add("Content-Disposition", "attachment")
+
+							fwl, err := valheim.OpenFWL(opts.SaveDir, opts.World)
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+							defer fwl.Close()
+
+							_, _ = io.Copy(w, fwl)
+						})
+					)
+
+					paths = append(paths,
+						exactPath("/seed.json", seedJSONHandler),
+						exactPath("/seed.txt", seedTxtHandler),
+						exactPath("/seed", seedHdrHandler),
+						exactPath("/map", mapHandler),
+						exactPath("/map.png", mapHandler),
+						prefixPath("/map/tiles", mapTileHandler),
+						exactPath("/world.fwl", fwlHandler),
+						exactPath(path.Join("/", fmt.Sprintf("%s.fwl", opts.World)), fwlHandler),
+					)
+				}
+
+				if !noDB && !noFWL {
+					var (
+						worldsTarHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+							w.Header().Add("Content-Type", "application/tar")
+							w.Header().Add("Content-Disposition", "attachment")
+
+							_, _ = io.Copy(w, xtar.Compress(filepath.Join(opts.SaveDir, "worlds_local")))
+						})
+						worldsTgzHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+							gzw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+							if err != nil {
+								gzw = gzip.NewWriter(w)
+							}
+							defer gzw.Close()
+
+							w.Header().Add("Content-Type", "application/tar")
+							w.Header().Add("Content-Encoding", "gzip")
+							w.Header().Add("Content-Disposition", "attachment")
+
+							_, _ = io.Copy(gzw, xtar.Compress(filepath.Join(opts.SaveDir, "worlds_local")))
+						})
+						worldsRestoreHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							ctx := r.Context()
+
+							tmp, err := os.MkdirTemp(opts.SaveDir, ".restore-*")
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+							defer os.RemoveAll(tmp)
+
+							var (
+								br  = bufio.NewReader(http.MaxBytesReader(w, r.Body, maxWorldsRestoreSize))
+								rdr = io.Reader(br)
+							)
+
+							if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+								gzr, err := gzip.NewReader(br)
+								if err != nil {
+									http.Error(w, err.Error(), http.StatusBadRequest)
+									return
+								}
+								defer gzr.Close()
+
+								// Bound what gets extracted too, not just what gets uploaded.
+								rdr = io.LimitReader(gzr, maxWorldsRestoreSize)
+							}
+
+							if err := valheim.ExtractWorlds(tar.NewReader(rdr), tmp); err != nil {
+								if maxBytesErr := new(http.MaxBytesError); errors.As(err, &maxBytesErr) {
+									http.Error(w, fmt.Sprintf("worlds must be at most %d bytes", maxWorldsRestoreSize), http.StatusRequestEntityTooLarge)
+									return
+								}
+
+								http.Error(w, err.Error(), http.StatusBadRequest)
+								return
+							}
+
+							worldFiles, err := valheim.FindWorld(tmp, opts.World)
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusBadRequest)
+								return
+							}
+
+							if server != nil {
+								log.Info("stopping Valheim server to restore world")
+
+								err := server.Stop(ctx)
+
+								defer func() {
+									log.Info("starting Valheim server after restore")
+									server.Start()
+								}()
+
+								// Without the world saved, the pre-restore
+								// snapshot would not have its latest state.
+								if err != nil {
+									http.Error(w, err.Error(), http.StatusInternalServerError)
+									return
+								}
+							}
+
+							if _, err := snapshotter.Snapshot(ctx); err != nil {
+								http.Error(w, fmt.Sprintf("taking pre-restore snapshot: %v", err), http.StatusInternalServerError)
 								return
 							}
 
-							seedTxtHandler(w, r)
-						})
-						mapHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-							seed, err := valheim.ReadWorldSeed(opts.SaveDir, opts.World)
-							if err != nil {
+							if err := valheim.InstallWorld(worldFiles, opts.SaveDir, opts.World); err != nil {
 								http.Error(w, err.Error(), http.StatusInternalServerError)
 								return
 							}
 
-							q := valheimMapURL.Query()
-							q.Set("seed", seed)
-							valheimMapURL.RawQuery = q.Encode()
+							log.Info("restored world", "name", worldFiles.Metadata.Name, "seed", worldFiles.Metadata.SeedName)
+
+							w.Header().Add("Content-Type", "application/json")
 
-							http.Redirect(w, r, valheimMapURL.String(), http.StatusTemporaryRedirect)
+							_ = json.NewEncoder(w).Encode(worldFiles.Metadata)
 						})
-						fwlHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-							w.Header().Add("Content-Disposition", "attachment")
+						worldsHdrHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							switch r.Method {
+							case http.MethodPut, http.MethodPost:
+								worldsRestoreHandler.ServeHTTP(w, r)
+								return
+							}
 
-							fwl, err := valheim.OpenFWL(opts.SaveDir, opts.World)
-							if err != nil {
-								http.Error(w, err.Error(), http.StatusInternalServerError)
+							if accept := r.Header.Get("Accept"); strings.Contains(accept, "application/tar") {
+								if acceptEncoding := r.Header.Get("Accept-Encoding"); strings.Contains(acceptEncoding, "gzip") {
+									w.Header().Add("Content-Disposition", "filename=file worlds.tar.gz")
+									worldsTgzHandler(w, r)
+									return
+								}
+
+								w.Header().Add("Content-Disposition", "filename=file worlds.tar")
+								worldsTarHandler(w, r)
 								return
 							}
-							defer fwl.Close()
 
-							_, _ = io.Copy(w, fwl)
+							w.WriteHeader(http.StatusNotAcceptable)
 						})
 					)
 
 					paths = append(paths,
-						ingress.ExactPath("/seed.json", seedJSONHandler),
-						ingress.ExactPath("/seed.txt", seedTxtHandler),
-						ingress.ExactPath("/seed", seedHdrHandler),
-						ingress.ExactPath("/map", mapHandler),
-						ingress.ExactPath("/world.fwl", fwlHandler),
-						ingress.ExactPath(path.Join("/", fmt.Sprintf("%s.fwl", opts.World)), fwlHandler),
+						exactPath("/worlds.tar", admin(worldsTarHandler)),
+						exactPath("/worlds.tar.gz", admin(worldsTgzHandler)),
+						exactPath("/worlds.tgz", admin(worldsTgzHandler)),
+						exactPath("/worlds_local.tar", admin(worldsTarHandler)),
+						exactPath("/worlds_local.tar.gz", admin(worldsTgzHandler)),
+						exactPath("/worlds_local.tgz", admin(worldsTgzHandler)),
+						exactPath("/worlds", admin(worldsHdrHandler)),
+						exactPath("/worlds_local", admin(worldsHdrHandler)),
 					)
-				}
 
-				if !noDB && !noFWL {
-					var (
-						worldsTarHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-							w.Header().Add("Content-Type", "application/tar")
-							w.Header().Add("Content-Disposition", "attachment")
+					log.Info("exposing backup-related endpoints")
 
-							_, _ = io.Copy(w, xtar.Compress(filepath.Join(opts.SaveDir, "worlds_local")))
-						})
-						worldsTgzHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-							gzw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+					var (
+						backupsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							snapshots, err := snapshotter.List(r.Context())
 							if err != nil {
-								gzw = gzip.NewWriter(w)
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
 							}
-							defer gzw.Close()
 
-							w.Header().Add("Content-Type", "application/tar")
-							w.Header().Add("Content-Encoding", "gzip")
-							w.Header().Add("Content-Disposition", "attachment")
+							w.Header().Add("Content-Type", "application/json")
 
-							_, _ = io.Copy(gzw, xtar.Compress(filepath.Join(opts.SaveDir, "worlds_local")))
+							_ = json.NewEncoder(w).Encode(snapshots)
 						})
-						worldsHdrHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-							if accept := r.Header.Get("Accept"); strings.Contains(accept, "application/tar") {
-								if acceptEncoding := r.Header.Get("Accept-Encoding"); strings.Contains(acceptEncoding, "gzip") {
-									w.Header().Add("Content-Disposition", "filename=file worlds.tar.gz")
-									worldsTgzHandler(w, r)
-									return
-								}
+						backupHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							name := path.Base(r.URL.Path)
 
-								w.Header().Add("Content-Disposition", "filename=file worlds.tar")
-								worldsTarHandler(w, r)
+							rc, err := snapshotter.Open(r.Context(), name)
+							if errors.Is(err, os.ErrNotExist) {
+								http.NotFound(w, r)
+								return
+							} else if err != nil {
+								http.Error(w, err.Error(), http.StatusBadRequest)
 								return
 							}
+							defer rc.Close()
 
-							w.WriteHeader(http.StatusNotAcceptable)
+							w.Header().Add("Content-Type", "application/tar")
+							w.Header().Add("Content-Encoding", "gzip")
+							w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+
+							_, _ = io.Copy(w, rc)
 						})
 					)
 
 					paths = append(paths,
-						ingress.ExactPath("/worlds.tar", worldsTarHandler),
-						ingress.ExactPath("/worlds.tar.gz", worldsTgzHandler),
-						ingress.ExactPath("/worlds.tgz", worldsTgzHandler),
-						ingress.ExactPath("/worlds_local.tar", worldsTarHandler),
-						ingress.ExactPath("/worlds_local.tar.gz", worldsTgzHandler),
-						ingress.ExactPath("/worlds_local.tgz", worldsTgzHandler),
-						ingress.ExactPath("/worlds", worldsHdrHandler),
-						ingress.ExactPath("/worlds_local", worldsHdrHandler),
+						exactPath("/backups", admin(backupsHandler), ingress.WithMatchIgnoreSlash),
+						prefixPath("/backups", admin(backupHandler)),
 					)
 				}
 
@@ -340,169 +1025,432 @@ func NewValheimw() *cobra.Command {
 					log.Info("exposing mod-related endpoints")
 
 					var (
-						modTarHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-							tw := tar.NewWriter(w)
-							defer tw.Close()
-
-							w.Header().Add("Content-Type", "application/tar")
-							w.Header().Add("Content-Disposition", "attachment")
+						// buildBundle builds the client mod bundle and keeps it
+						// unless another install happened since generation.
+						buildBundle = func(generation int) (*bundle.Bundle, error) {
+							var (
+								bundlePkgs    = []bundle.Package{}
+								excludeConfig = slices.Clone(modBundleExcludeConfig)
+							)
 
 							for _, pkg := range pkgs {
-								if pkg.Namespace == bepInExNamespace && pkg.Name == bepInExName {
+								dir := path.Join("BepInEx/plugins", pkg.String())
+
+								if thunderstore.DefaultClient.IsBepInExPack(&pkg) {
+									dir = "."
+								} else if pkg.IsModpack() {
 									continue
-								} else if xslices.Every(pkg.CommunityListings, func(communityListing thunderstore.CommunityListing, _ int) bool {
-									return !slices.Contains(communityListing.Categories, "Server-side")
-								}) {
+								} else if !hasCategory(&pkg, "Client-side") && !hasCategory(&pkg, "Server-side") {
 									continue
 								}
 
-								rc, err := valheimw.Open(ctx, fmt.Sprintf("%s://%s", thunderstore.Scheme, pkg.String()))
-								if err != nil {
-									http.Error(w, err.Error(), http.StatusInternalServerError)
-									return
+								// Server-only mods' config can hold secrets, e.g. passwords. Their config
+								// files are usually named after their plugin GUID, which tends to
+								// contain the package's name, so leave out any that do.
+								if hasCategory(&pkg, "Server-side") && !hasCategory(&pkg, "Client-side") {
+									excludeConfig = append(excludeConfig, fmt.Sprintf("*%s*", strings.NewReplacer("_", "", "-", "").Replace(pkg.Name)))
 								}
-								defer rc.Close()
 
-								tr := tar.NewReader(rc)
+								bundlePkgs = append(bundlePkgs, bundle.Package{Package: lock.NewPackage(&pkg, pkg.SHA256), Dir: dir})
+							}
+
+							log.Info("building client mod bundle", "packages", len(bundlePkgs))
 
-								for {
-									hdr, err := tr.Next()
-									if errors.Is(err, io.EOF) {
-										break
-									} else if err != nil {
-										http.Error(w, err.Error(), http.StatusInternalServerError)
-										return
-									}
+							// The build is shared by every request waiting
+							// for it, so it must not be canceled by any of them.
+							b, err := bundle.Build(ctx, filepath.Join(cache.Dir, "mods"), bundlePkgs, &bundle.BuildOpts{
+								ConfigDir:     filepath.Join(wd, "BepInEx/config"),
+								ExcludeConfig: excludeConfig,
+								ProfileName:   cmp.Or(opts.Name, "valheimw"),
+							})
+							if err != nil {
+								return nil, fmt.Errorf("building client mod bundle: %w", err)
+							}
 
-									base := path.Base(hdr.Name)
+							modBundleMu.Lock()
+							defer modBundleMu.Unlock()
 
-									if ext := path.Ext(base); ext != ".dll" {
-										continue
-									} else {
-										hdr.Name = path.Join("BepInEx/plugins", pkg.String(), base)
-									}
+							if generation == modBundleGeneration {
+								modBundle = b
+								modProfileCode = ""
+							}
 
-									if err = tw.WriteHeader(hdr); err != nil {
-										http.Error(w, err.Error(), http.StatusInternalServerError)
-										return
-									}
+							return b, nil
+						}
+						modBundleBuilds singleflight.Group
+						// getBundle builds the client mod bundle the first time that it is
+						// requested after each install and reuses it until the next one.
+						getBundle = func(ctx context.Context) (*bundle.Bundle, error) {
+							for {
+								modBundleMu.Lock()
+								b, generation := modBundle, modBundleGeneration
+								modBundleMu.Unlock()
+
+								if b != nil {
+									return b, nil
+								}
 
-									//nolint:gosec
-									if _, err = io.Copy(tw, tr); err != nil {
-										http.Error(w, err.Error(), http.StatusInternalServerError)
-										return
+								// Builds are done one at a time. If the one that this joined was
+								// for a previous install, it was not kept, so go again.
+								select {
+								case <-ctx.Done():
+									return nil, ctx.Err()
+								case res := <-modBundleBuilds.DoChan("", func() (any, error) {
+									return buildBundle(generation)
+								}):
+									if res.Err != nil {
+										return nil, res.Err
 									}
 								}
 							}
-						})
-						modTgzHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-							gzw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+						}
+					)
+
+					var (
+						// shareProfile shares b's profile via Thunderstore and
+						// keeps the code unless b has been rebuilt since.
+						shareProfile = func(b *bundle.Bundle) (string, error) {
+							log.Info("sharing client mod profile")
+
+							// The upload is shared by every request waiting
+							// for it, so it must not be canceled by any of them.
+							code, err := thunderstore.DefaultClient.CreateProfile(ctx, b.Profile)
 							if err != nil {
-								gzw = gzip.NewWriter(w)
+								return "", fmt.Errorf("sharing client mod profile: %w", err)
 							}
-							defer gzw.Close()
 
-							tw := tar.NewWriter(gzw)
-							defer tw.Close()
+							modBundleMu.Lock()
+							defer modBundleMu.Unlock()
 
-							w.Header().Add("Content-Type", "application/tar")
-							w.Header().Add("Content-Encoding", "application/gzip")
-							w.Header().Add("Content-Disposition", "attachment")
+							if b == modBundle {
+								modProfileCode = code
+							}
 
-							for _, pkg := range pkgs {
-								if pkg.Namespace == bepInExNamespace && pkg.Name == bepInExName {
-									continue
-								} else if !xslices.Some(pkg.CommunityListings, func(communityListing thunderstore.CommunityListing, _ int) bool {
-									return slices.Contains(communityListing.Categories, "Client-side")
-								}) {
-									continue
-								}
+							return code, nil
+						}
+						modProfileShares singleflight.Group
+						// getProfileCode shares the client mod bundle's profile via Thunderstore
+						// the first time that it is requested and reuses the code until the
+						// bundle gets rebuilt.
+						getProfileCode = func(ctx context.Context) (string, error) {
+							b, err := getBundle(ctx)
+							if err != nil {
+								return "", err
+							}
 
-								rc, err := valheimw.Open(ctx, fmt.Sprintf("%s://%s", thunderstore.Scheme, pkg.String()))
-								if err != nil {
-									http.Error(w, err.Error(), http.StatusInternalServerError)
-									return
-								}
-								defer rc.Close()
+							modBundleMu.Lock()
+							code := modProfileCode
+							if b != modBundle {
+								code = ""
+							}
+							modBundleMu.Unlock()
 
-								tr := tar.NewReader(rc)
+							if code != "" {
+								return code, nil
+							}
 
-								for {
-									hdr, err := tr.Next()
-									if errors.Is(err, io.EOF) {
-										break
-									} else if err != nil {
-										http.Error(w, err.Error(), http.StatusInternalServerError)
-										return
-									}
+							// The same profile always has the same ETag, so
+							// requests for it can share a single upload.
+							select {
+							case <-ctx.Done():
+								return "", ctx.Err()
+							case res := <-modProfileShares.DoChan(b.R2z.ETag, func() (any, error) {
+								return shareProfile(b)
+							}):
+								if res.Err != nil {
+									return "", res.Err
+								}
 
-									base := path.Base(hdr.Name)
+								return res.Val.(string), nil
+							}
+						}
+					)
 
-									if ext := path.Ext(base); ext != ".dll" {
-										continue
-									} else {
-										hdr.Name = path.Join("BepInEx/plugins", pkg.String(), base)
-									}
+					modBundleHandler := func(compressed bool) http.HandlerFunc {
+						return func(w http.ResponseWriter, r *http.Request) {
+							b, err := getBundle(r.Context())
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
 
-									if err = tw.WriteHeader(hdr); err != nil {
-										http.Error(w, err.Error(), http.StatusInternalServerError)
-										return
-									}
+							w.Header().Add("Content-Type", "application/tar")
 
-									//nolint:gosec
-									if _, err = io.Copy(tw, tr); err != nil {
-										http.Error(w, err.Error(), http.StatusInternalServerError)
-										return
-									}
-								}
+							if compressed {
+								w.Header().Add("Content-Encoding", "gzip")
+								w.Header().Add("Content-Disposition", "attachment; filename=mods.tar.gz")
+								b.Tgz.ServeHTTP(w, r)
+								return
 							}
-						})
+
+							w.Header().Add("Content-Disposition", "attachment; filename=mods.tar")
+							b.Tar.ServeHTTP(w, r)
+						}
+					}
+
+					var (
+						modTarHandler = modBundleHandler(false)
+						modTgzHandler = modBundleHandler(true)
 						modHdrHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 							if accept := r.Header.Get("Accept"); strings.Contains(accept, "application/tar") {
 								if acceptEncoding := r.Header.Get("Accept-Encoding"); strings.Contains(acceptEncoding, "gzip") {
-									w.Header().Add("Content-Disposition", "filename=file mods.tar.gz")
 									modTgzHandler(w, r)
+									return
 								}
-								w.Header().Add("Content-Disposition", "filename=file mods.tar")
+
 								modTarHandler(w, r)
 								return
 							}
 
 							w.WriteHeader(http.StatusNotAcceptable)
 						})
+						modR2zHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							b, err := getBundle(r.Context())
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+
+							w.Header().Add("Content-Type", "application/zip")
+							w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%s.r2z", b.Profile.Name))
+
+							b.R2z.ServeHTTP(w, r)
+						})
+						modProfileCodeHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							code, err := getProfileCode(r.Context())
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusBadGateway)
+								return
+							}
+
+							w.Header().Add("Content-Type", "text/plain")
+
+							_, _ = fmt.Fprintln(w, code)
+						})
+						modManifestHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							b, err := getBundle(r.Context())
+							if err != nil {
+								http.Error(w, err.Error(), http.StatusInternalServerError)
+								return
+							}
+
+							w.Header().Add("Content-Type", "application/json")
+
+							_ = json.NewEncoder(w).Encode(b.Manifest)
+						})
 					)
 
 					paths = append(paths,
-						ingress.ExactPath("/mods.tar", modTarHandler),
-						ingress.ExactPath("/mods.gz", modTgzHandler),
-						ingress.ExactPath("/mods.tgz", modTgzHandler),
-						ingress.ExactPath("/mods.tar.gz", modTgzHandler),
-						ingress.ExactPath("/mods", modHdrHandler),
+						exactPath("/mods.tar", modTarHandler),
+						exactPath("/mods.gz", modTgzHandler),
+						exactPath("/mods.tgz", modTgzHandler),
+						exactPath("/mods.tar.gz", modTgzHandler),
+						exactPath("/mods.json", modManifestHandler),
+						exactPath("/mods.r2z", modR2zHandler),
+						// Sharing the profile uploads it to Thunderstore.
+						exactPath("/mods/profile-code", admin(modProfileCodeHandler)),
+						exactPath("/mods", modHdrHandler),
 					)
 				}
 
+				l, err := net.Listen("tcp", fmt.Sprintf(":%d", addr))
+				if err != nil {
+					return err
+				}
+				defer l.Close()
+
+				defer func() {
+					installMu.Lock()
+					defer installMu.Unlock()
+
+					restoreConfig()
+				}()
+
 				eg, egctx := errgroup.WithContext(ctx)
 
-				if !noValheim {
-					sub, err := valheim.NewCommand(egctx, wd, opts)
-					if err != nil {
-						return err
+				if snapshotInterval > 0 {
+					log.Info("taking snapshots", "interval", snapshotInterval)
+
+					eg.Go(func() error {
+						return snapshotter.Run(egctx, snapshotInterval)
+					})
+				}
+
+				if len(webhooks) == 0 {
+					webhooks = strings.Fields(os.Getenv("VALHEIMW_WEBHOOK"))
+				}
+
+				if len(discordWebhooks) == 0 {
+					discordWebhooks = strings.Fields(os.Getenv("VALHEIMW_DISCORD_WEBHOOK"))
+				}
+
+				var (
+					notifier = &notify.Notifier{}
+					// stopNotifying stops the notifier's subscription to
+					// Valheim's events once the server has exited.
+					stopNotifying = func() {}
+				)
+				for _, webhook := range webhooks {
+					notifier.Webhooks = append(notifier.Webhooks, notify.Webhook{URL: webhook, Format: notify.FormatJSON})
+				}
+				for _, webhook := range discordWebhooks {
+					notifier.Webhooks = append(notifier.Webhooks, notify.Webhook{URL: webhook, Format: notify.FormatDiscord})
+				}
+
+				if server != nil {
+					events := logs.Subscribe(egctx, 64)
+
+					eg.Go(func() error {
+						return roster.Run(egctx, events)
+					})
+
+					metrics.MustRegisterServer(server, roster, opts.SaveDir, opts.World)
+
+					var (
+						metricsEvents = logs.Subscribe(egctx, 64)
+						observeDay    = func() {
+							if worldDB, err := valheim.ReadWorldDB(opts.SaveDir, opts.World, valheim.WithoutZDOs); err == nil {
+								metrics.WorldDay.Set(float64(worldDB.Day()))
+							}
+						}
+					)
+
+					observeDay()
+
+					eg.Go(func() error {
+						for event := range metricsEvents {
+							switch event.Type {
+							case valheim.EventWorldSaved:
+								metrics.WorldSaveDuration.Observe(event.Duration.Seconds())
+								observeDay()
+							case valheim.EventDay:
+								metrics.WorldDay.Set(float64(event.Day))
+							}
+						}
+
+						return nil
+					})
+				}
+
+				if server != nil && len(notifier.Webhooks) > 0 {
+					log.Info("notifying webhooks", "count", len(notifier.Webhooks))
+
+					var (
+						// The notifier and its subscription outlive egctx so that the events
+						// that the Valheim server publishes as it shuts down, e.g.
+						// server_stopped, still get posted.
+						notifyCtx           = context.WithoutCancel(egctx)
+						subCtx, unsubscribe = context.WithCancel(notifyCtx)
+						events              = logs.Subscribe(subCtx, 64)
+						readDefeated        = func() (map[string]bool, error) {
+							worldDB, err := valheim.ReadWorldDB(opts.SaveDir, opts.World, valheim.WithoutZDOs)
+							if err != nil {
+								return nil, err
+							}
+
+							defeated := map[string]bool{}
+							for _, boss := range worldDB.Progress().Bosses {
+								defeated[boss.Name] = boss.Defeated
+							}
+
+							return defeated, nil
+						}
+						// Bosses are defeated when their global key gets set, which is
+						// only written to disk when the world is saved, so compare
+						// the bosses that were defeated before and after each save.
+						defeated, _ = readDefeated()
+					)
+
+					stopNotifying = unsubscribe
+
+					eg.Go(func() error {
+						return notifier.Run(notifyCtx)
+					})
+
+					updater.OnUpdateAvailable = func(buildID int) {
+						notifier.Notify(egctx, notify.Event{Type: notify.EventUpdateAvailable, Server: opts.Name, BuildID: strconv.Itoa(buildID)})
 					}
 
-					sub.Stdin = cmd.InOrStdin()
-					sub.Stdout = cmd.OutOrStdout()
-					sub.Stderr = cmd.ErrOrStderr()
+					eg.Go(func() error {
+						for event := range events {
+							switch event.Type {
+							case valheim.EventServerConnected:
+								notifier.Notify(egctx, notify.Event{Type: notify.EventServerStarted, Time: event.Time, Server: opts.Name})
+							case valheim.EventServerStopped:
+								notifier.Notify(egctx, notify.Event{Type: notify.EventServerStopped, Time: event.Time, Server: opts.Name})
+							case valheim.EventServerExited:
+								notifier.Notify(egctx, notify.Event{Type: notify.EventServerCrashed, Time: event.Time, Server: opts.Name, Error: event.Error})
+							case valheim.EventPlayerJoined:
+								notifier.Notify(egctx, notify.Event{Type: notify.EventPlayerJoined, Time: event.Time, Server: opts.Name, Player: event.Name, PlatformID: event.PlatformID})
+							case valheim.EventPlayerDisconnected:
+								notifier.Notify(egctx, notify.Event{Type: notify.EventPlayerLeft, Time: event.Time, Server: opts.Name, Player: event.Name, PlatformID: event.PlatformID})
+							case valheim.EventWorldSaved:
+								current, err := readDefeated()
+								if err != nil {
+									log.Warn("reading world to check for defeated bosses", "err", err)
+									continue
+								}
+
+								for _, boss := range valheim.Bosses {
+									if current[boss.Name] && defeated != nil && !defeated[boss.Name] {
+										notifier.Notify(egctx, notify.Event{Type: notify.EventBossDefeated, Time: event.Time, Server: opts.Name, Boss: boss.Name})
+									}
+								}
+
+								defeated = current
+							}
+						}
+
+						// The events stop once the Valheim server has exited,
+						// so post what is left of them, but not forever.
+						shutdownCtx, cancel := context.WithTimeout(notifyCtx, notifyShutdownTimeout)
+						defer cancel()
+
+						if err := notifier.Shutdown(shutdownCtx); err != nil {
+							log.Warn("dropping webhook events that were not posted before shutting down", "err", err)
+						}
+
+						return nil
+					})
+				}
 
-					log.Info("starting Valheim server")
+				if server != nil && updateInterval > 0 {
+					log.Info("checking for Valheim server updates", "interval", updateInterval)
 
-					eg.Go(sub.Run)
+					eg.Go(func() error {
+						return updater.Run(egctx)
+					})
 				}
 
-				l, err := net.Listen("tcp", fmt.Sprintf(":%d", addr))
-				if err != nil {
-					return err
+				if server != nil {
+					eg.Go(func() error {
+						defer stopNotifying()
+
+						installMu.Lock()
+						err := install(egctx)
+						installMu.Unlock()
+						if err != nil {
+							return err
+						}
+
+						log.Info("starting Valheim server")
+
+						err = server.Run(egctx)
+
+						if !noShutdownSnapshot {
+							// Snapshot the world that the Valheim server just saved
+							// before exiting so that it is not lost, e.g. to a pod eviction.
+							snapshotCtx, cancel := context.WithTimeout(context.WithoutCancel(egctx), shutdownTimeout)
+							defer cancel()
+
+							if _, err := snapshotter.Snapshot(snapshotCtx); err != nil {
+								log.Error("taking shutdown snapshot", "err", err)
+							}
+						}
+
+						return err
+					})
 				}
-				defer l.Close()
 
 				srv := &http.Server{
 					ReadHeaderTimeout: time.Second * 5,
@@ -531,13 +1479,20 @@ func NewValheimw() *cobra.Command {
 		}
 	)
 
+	cmd.AddCommand(NewMods())
+
 	cmd.Flags().StringArrayVarP(&mods, "mod", "m", nil, "Thunderstore mods (case-sensitive)")
+	cmd.Flags().StringArrayVar(&modBundleExcludeConfig, "mod-bundle-exclude-config", nil, "Pattern of BepInEx config files to leave out of the client mod bundle, e.g. *serverdevcommands*")
+	cmd.Flags().StringVar(&modProfile, "mod-profile", "", "r2modman or Thunderstore Mod Manager profile code or exported .r2z file to install the mods and config of")
+	cmd.Flags().BoolVar(&offline, "offline", false, "Resolve and download Thunderstore mods only from the cache")
+	cmd.Flags().BoolVar(&updateLock, "update-lock", false, "Resolve mods again and rewrite the lockfile in the savedir instead of installing exactly what it specifies, which is required to install a Valheim server build other than the locked one")
 
 	cmd.Flags().BoolVar(&noDB, "no-db", false, "Do not expose the world .db file for download")
 	cmd.Flags().BoolVar(&noFWL, "no-fwl", false, "Do not expose the world .fwl file information")
 	cmd.Flags().BoolVar(&noValheim, "no-valheim", false, "Do not run Valheim")
 
 	cmd.Flags().StringVar(&valheimMapWorldVersion, "valheim-map-world-version", "0.221.4", "Version of valheim-map.world to redirect to")
+	_ = cmd.Flags().MarkDeprecated("valheim-map-world-version", "the map is now rendered by valheimw")
 
 	cmd.Flags().IntVar(&addr, "addr", 8080, "Port for valheimw to listen on")
 
@@ -552,6 +1507,31 @@ func NewValheimw() *cobra.Command {
 	cmd.Flags().DurationVar(&opts.BackupShort, "backup-short", 0, "Valheim server -backupshort duration")
 	cmd.Flags().DurationVar(&opts.BackupLong, "backup-long", 0, "Valheim server -backuplong duration")
 
+	cmd.Flags().DurationVar(&snapshotInterval, "snapshot-interval", 0, "How often to snapshot the world (0 to disable)")
+	cmd.Flags().StringVar(&snapshotTarget, "snapshot-target", "", "URL to ship world snapshots to, e.g. s3://bucket/prefix or file:///backups (default <savedir>/snapshots)")
+	cmd.Flags().IntVar(&snapshotter.Retention.KeepLast, "snapshot-keep-last", 5, "Number of most recent snapshots to keep")
+	cmd.Flags().IntVar(&snapshotter.Retention.KeepDaily, "snapshot-keep-daily", 7, "Number of most recent days to keep a snapshot of")
+	cmd.Flags().IntVar(&snapshotter.Retention.KeepWeekly, "snapshot-keep-weekly", 4, "Number of most recent weeks to keep a snapshot of")
+
+	cmd.Flags().StringArrayVar(&authenticator.Tokens, "admin-token", nil, "Bearer token for admin endpoints, e.g. /worlds and /backups, which deny every request unless this or --admin-password is set (default $VALHEIMW_ADMIN_TOKEN)")
+	cmd.Flags().StringVar(&adminUsername, "admin-username", "admin", "Basic auth username for admin endpoints")
+	cmd.Flags().StringVar(&adminPassword, "admin-password", "", "Basic auth password for admin endpoints, which deny every request unless this or --admin-token is set (default $VALHEIMW_ADMIN_PASSWORD)")
+
+	cmd.Flags().BoolVar(&noRestart, "no-restart", false, "Exit instead of restarting Valheim if it crashes")
+	cmd.Flags().DurationVar(&restartPolicy.Backoff, "restart-backoff", restartPolicy.Backoff, "How long to wait before restarting Valheim after it crashes")
+	cmd.Flags().DurationVar(&restartPolicy.MaxBackoff, "restart-max-backoff", restartPolicy.MaxBackoff, "Longest to wait before restarting Valheim after it crashes")
+	cmd.Flags().IntVar(&restartPolicy.MaxRestarts, "max-restarts", restartPolicy.MaxRestarts, "How many times Valheim may be restarted within --restart-window before it is considered to be crash looping")
+	cmd.Flags().DurationVar(&restartPolicy.Window, "restart-window", restartPolicy.Window, "Window of time that --max-restarts applies to")
+
+	cmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", valheim.DefaultShutdownTimeout, "How long to wait for Valheim to save the world and exit before killing it, and then for the shutdown snapshot to be taken")
+	cmd.Flags().BoolVar(&noShutdownSnapshot, "no-shutdown-snapshot", false, "Do not snapshot the world after Valheim exits")
+
+	cmd.Flags().DurationVar(&updateInterval, "update-interval", 0, "How often to check for and apply Valheim server updates (0 to disable)")
+	cmd.Flags().DurationVar(&updateMaxDelay, "update-max-delay", valheim.DefaultUpdateMaxDelay, "Longest to wait for players to leave before applying a Valheim server update")
+
+	cmd.Flags().StringArrayVar(&webhooks, "webhook", nil, "URL to POST server events to as JSON (default $VALHEIMW_WEBHOOK)")
+	cmd.Flags().StringArrayVar(&discordWebhooks, "discord-webhook", nil, "Discord webhook URL to post server events to (default $VALHEIMW_DISCORD_WEBHOOK)")
+
 	cmd.Flags().BoolVar(&opts.Crossplay, "crossplay", false, "Valheim server enable -crossplay")
 
 	cmd.Flags().StringVar(&opts.InstanceID, "instance-id", "", "Valheim server -instanceid")
@@ -665,3 +1645,9 @@ func NewValheimw() *cobra.Command {
 
 	return cmd
 }
+
+func hasCategory(pkg *thunderstore.Package, category string) bool {
+	return xslices.Some(pkg.CommunityListings, func(communityListing thunderstore.CommunityListing, _ int) bool {
+		return slices.Contains(communityListing.Categories, category)
+	})
+}
@@ -0,0 +1,33 @@
+package command_test
+
+import (
+	"testing"
+
+	"github.com/frantjc/valheimw/command"
+)
+
+func TestValheimwArgs(t *testing.T) {
+	cmd := command.NewValheimw()
+
+	found, args, err := cmd.Find([]string{"foo", "bar"})
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+
+	if found != cmd {
+		t.Fatalf("expected root command, got %q", found.Name())
+	}
+
+	if err := found.ValidateArgs(args); err != nil {
+		t.Fatalf("validate args: %v", err)
+	}
+
+	found, _, err = cmd.Find([]string{"mods", "search"})
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+
+	if found.Name() != "search" {
+		t.Fatalf("expected search command, got %q", found.Name())
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Scope is the level of access that a route requires.
+type Scope int
+
+const (
+	// ScopePublic routes can be accessed by anyone.
+	ScopePublic Scope = iota
+	// ScopeAdmin routes can only be accessed with valid credentials.
+	ScopeAdmin
+)
+
+func (s Scope) String() string {
+	switch s {
+	case ScopePublic:
+		return "public"
+	case ScopeAdmin:
+		return "admin"
+	}
+
+	return fmt.Sprintf("Scope(%d)", int(s))
+}
+
+const (
+	// DefaultRealm is the realm advertised to clients
+	// if an Authenticator does not specify one.
+	DefaultRealm = "valheimw"
+)
+
+// Authenticator checks requests for either a bearer token
+// or HTTP basic auth credentials.
+type Authenticator struct {
+	// Tokens are accepted as `Authorization: Bearer <token>`.
+	Tokens []string
+	// Users maps usernames to passwords that
+	// are accepted as HTTP basic auth.
+	Users map[string]string
+	// Realm is advertised in WWW-Authenticate headers.
+	Realm string
+}
+
+// Enabled reports whether any credentials are configured.
+// If not, nothing can authenticate as an admin.
+func (a *Authenticator) Enabled() bool {
+	if a == nil {
+		return false
+	}
+
+	for _, token := range a.Tokens {
+		if token != "" {
+			return true
+		}
+	}
+
+	for username, password := range a.Users {
+		if username != "" && password != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticate reports whether r carries valid credentials.
+func (a *Authenticator) Authenticate(r *http.Request) bool {
+	if !a.Enabled() {
+		return false
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, t := range a.Tokens {
+			if t != "" && equal(token, t) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		// Check every user so that the time taken
+		// does not leak which usernames exist.
+		authenticated := false
+
+		for u, p := range a.Users {
+			if u != "" && p != "" && equal(username, u) && equal(password, p) {
+				authenticated = true
+			}
+		}
+
+		return authenticated
+	}
+
+	return false
+}
+
+// equal compares a and b in constant time. They are hashed
+// first so that the length of the secret is not leaked either.
+func equal(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+func (a *Authenticator) realm() string {
+	if a != nil && a.Realm != "" {
+		return a.Realm
+	}
+
+	return DefaultRealm
+}
+
+// Handler wraps h such that it can only be accessed with the given Scope.
+// ScopeAdmin routes respond 401 to requests without valid credentials
+// and 403 to every request if no credentials are configured.
+func (a *Authenticator) Handler(scope Scope, h http.Handler) http.Handler {
+	if scope == ScopePublic {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			http.Error(w, fmt.Sprintf("%s endpoints are disabled: no credentials configured", scope), http.StatusForbidden)
+			return
+		}
+
+		if !a.Authenticate(r) {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", a.realm()))
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", a.realm()))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,99 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/frantjc/valheimw/internal/auth"
+)
+
+func TestAuthenticatorHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		name     string
+		auth     *auth.Authenticator
+		scope    auth.Scope
+		setup    func(*http.Request)
+		expected int
+	}{
+		{
+			name:     "public",
+			auth:     &auth.Authenticator{},
+			scope:    auth.ScopePublic,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "admin disabled",
+			auth:     &auth.Authenticator{},
+			scope:    auth.ScopeAdmin,
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") },
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "admin without credentials",
+			auth:     &auth.Authenticator{Tokens: []string{"token"}},
+			scope:    auth.ScopeAdmin,
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "admin bearer",
+			auth:     &auth.Authenticator{Tokens: []string{"other", "token"}},
+			scope:    auth.ScopeAdmin,
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			expected: http.StatusOK,
+		},
+		{
+			name:     "admin wrong bearer",
+			auth:     &auth.Authenticator{Tokens: []string{"token"}},
+			scope:    auth.ScopeAdmin,
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer tokem") },
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "admin basic",
+			auth:     &auth.Authenticator{Users: map[string]string{"admin": "password"}},
+			scope:    auth.ScopeAdmin,
+			setup:    func(r *http.Request) { r.SetBasicAuth("admin", "password") },
+			expected: http.StatusOK,
+		},
+		{
+			name:     "admin wrong basic",
+			auth:     &auth.Authenticator{Users: map[string]string{"admin": "password"}},
+			scope:    auth.ScopeAdmin,
+			setup:    func(r *http.Request) { r.SetBasicAuth("admin", "token") },
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "admin basic password as bearer",
+			auth:     &auth.Authenticator{Users: map[string]string{"admin": "password"}},
+			scope:    auth.ScopeAdmin,
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer password") },
+			expected: http.StatusUnauthorized,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				w = httptest.NewRecorder()
+				r = httptest.NewRequest(http.MethodGet, "/", nil)
+			)
+
+			if tc.setup != nil {
+				tc.setup(r)
+			}
+
+			tc.auth.Handler(tc.scope, ok).ServeHTTP(w, r)
+
+			if w.Code != tc.expected {
+				t.Fatalf("expected status %d, got %d", tc.expected, w.Code)
+			}
+
+			if w.Code == http.StatusUnauthorized && len(w.Header().Values("WWW-Authenticate")) == 0 {
+				t.Fatal("expected WWW-Authenticate header")
+			}
+		})
+	}
+}
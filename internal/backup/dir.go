@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	Register(
+		new(DirTargetOpener),
+		DirScheme,
+	)
+}
+
+const (
+	DirScheme = "file"
+
+	checksumExt = ".sha256"
+)
+
+type DirTargetOpener struct{}
+
+func (o *DirTargetOpener) Open(_ context.Context, u *url.URL) (Target, error) {
+	if u.Scheme != DirScheme {
+		return nil, fmt.Errorf("invalid scheme %s, expected %s", u.Scheme, DirScheme)
+	}
+
+	return &DirTarget{Dir: filepath.FromSlash(u.Path)}, nil
+}
+
+// DirTarget is a Target that stores objects in a local directory
+// alongside `sha256sum`-formatted checksum files.
+type DirTarget struct {
+	Dir string
+}
+
+func (t *DirTarget) path(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid object name %s", name)
+	}
+
+	return filepath.Join(t.Dir, name), nil
+}
+
+func (t *DirTarget) Put(_ context.Context, obj *Object, r io.Reader) error {
+	name, err := t.path(obj.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(t.Dir, "."+obj.Name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var (
+		hash = sha256.New()
+		n    int64
+	)
+
+	if n, err = io.Copy(io.MultiWriter(f, hash), r); err != nil {
+		return err
+	}
+
+	if err := verify(obj, n, hash.Sum(nil)); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if obj.SHA256 != "" {
+		if err := os.WriteFile(name+checksumExt, []byte(fmt.Sprintf("%s  %s\n", obj.SHA256, obj.Name)), 0644); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+func (t *DirTarget) List(_ context.Context) ([]Object, error) {
+	entries, err := os.ReadDir(t.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Object{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	objs := []Object{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) == checksumExt {
+			continue
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		obj := Object{Name: entry.Name(), Size: fi.Size(), ModTime: fi.ModTime()}
+
+		if b, err := os.ReadFile(filepath.Join(t.Dir, entry.Name()+checksumExt)); err == nil {
+			obj.SHA256, _, _ = strings.Cut(string(b), " ")
+		}
+
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
+
+func (t *DirTarget) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	name, err := t.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(name)
+}
+
+func (t *DirTarget) Delete(_ context.Context, name string) error {
+	name, err := t.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name + checksumExt); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return os.Remove(name)
+}
+
+// verify checks that n bytes with the given checksum
+// were written for obj, to the extent that obj knows.
+func verify(obj *Object, n int64, sum []byte) error {
+	if obj.Size > 0 && n != obj.Size {
+		return fmt.Errorf("size mismatch for %s: expected %d, got %d", obj.Name, obj.Size, n)
+	}
+
+	if actual := hex.EncodeToString(sum); obj.SHA256 != "" && !strings.EqualFold(actual, obj.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", obj.Name, obj.SHA256, actual)
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+package backup
+
+import (
+	"net/http"
+	"time"
+)
+
+// Sign exposes sign to backup_test.
+func (t *S3Target) Sign(req *http.Request, payloadHash string, now time.Time) {
+	t.sign(req, payloadHash, now)
+}
@@ -0,0 +1,414 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(
+		new(S3TargetOpener),
+		S3Scheme,
+	)
+}
+
+const (
+	S3Scheme = "s3"
+
+	defaultS3Region  = "us-east-1"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3TargetOpener opens S3Targets from URLs of the form
+// `s3://bucket/prefix?region=us-east-1&endpoint=http://localhost:9000`.
+// Credentials are read from the standard AWS_* environment variables.
+// If an endpoint is given, path-style requests are made to it so that
+// S3-compatible APIs such as MinIO can be used.
+type S3TargetOpener struct{}
+
+func (o *S3TargetOpener) Open(_ context.Context, u *url.URL) (Target, error) {
+	if u.Scheme != S3Scheme {
+		return nil, fmt.Errorf("invalid scheme %s, expected %s", u.Scheme, S3Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("s3 URL must specify a bucket")
+	}
+
+	var (
+		q = u.Query()
+		t = &S3Target{
+			Bucket:          u.Host,
+			Prefix:          strings.Trim(u.Path, "/"),
+			Region:          firstNonEmpty(q.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), defaultS3Region),
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	)
+
+	if endpoint := firstNonEmpty(q.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")); endpoint != "" {
+		e, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		t.Endpoint = e
+	}
+
+	return t, nil
+}
+
+func firstNonEmpty(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
+
+// S3Target is a Target that stores objects in an S3-compatible bucket.
+// Requests are signed with AWS Signature Version 4 over the SHA-256 of
+// the payload, so the server rejects uploads that were corrupted in transit.
+type S3Target struct {
+	Bucket          string
+	Prefix          string
+	Region          string
+	Endpoint        *url.URL
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	HTTPClient      *http.Client
+}
+
+func (t *S3Target) httpClient() *http.Client {
+	if t.HTTPClient != nil {
+		return t.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func (t *S3Target) bucketURL() *url.URL {
+	if t.Endpoint != nil {
+		return t.Endpoint.JoinPath(t.Bucket)
+	}
+
+	return &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", t.Bucket, t.Region), Path: "/"}
+}
+
+func (t *S3Target) key(name string) (string, error) {
+	if name == "" || name != path.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid object name %s", name)
+	}
+
+	return path.Join(t.Prefix, name), nil
+}
+
+func (t *S3Target) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	t.sign(req, payloadHash, time.Now())
+
+	res, err := t.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		defer res.Body.Close()
+
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		err := fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, res.Status, strings.TrimSpace(string(b)))
+
+		if res.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %w", os.ErrNotExist, err)
+		}
+
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (t *S3Target) Put(ctx context.Context, obj *Object, r io.Reader) error {
+	key, err := t.key(obj.Name)
+	if err != nil {
+		return err
+	}
+
+	if obj.Size <= 0 {
+		return fmt.Errorf("s3 uploads require the size of %s to be known", obj.Name)
+	}
+
+	// The transport closes request bodies that are io.Closers,
+	// but r belongs to the caller, which may want to retry with it.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.bucketURL().JoinPath(key).String(), io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = obj.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	payloadHash := "UNSIGNED-PAYLOAD"
+	if obj.SHA256 != "" {
+		sum, err := hex.DecodeString(obj.SHA256)
+		if err != nil {
+			return err
+		}
+
+		payloadHash = strings.ToLower(obj.SHA256)
+		req.Header.Set("x-amz-checksum-sha256", base64.StdEncoding.EncodeToString(sum))
+	}
+
+	res, err := t.do(req, payloadHash)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (t *S3Target) List(ctx context.Context) ([]Object, error) {
+	var (
+		objs   = []Object{}
+		prefix = ""
+		token  = ""
+	)
+
+	if t.Prefix != "" {
+		prefix = t.Prefix + "/"
+	}
+
+	for {
+		u := t.bucketURL()
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := t.do(req, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &listBucketResult{}
+		err = xml.NewDecoder(res.Body).Decode(result)
+		_ = res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			name := strings.TrimPrefix(content.Key, prefix)
+			if strings.Contains(name, "/") {
+				continue
+			}
+
+			objs = append(objs, Object{Name: name, Size: content.Size, ModTime: content.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objs, nil
+		}
+
+		token = result.NextContinuationToken
+	}
+}
+
+func (t *S3Target) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, err := t.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.bucketURL().JoinPath(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+func (t *S3Target) Delete(ctx context.Context, name string) error {
+	key, err := t.key(name)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.bucketURL().JoinPath(key).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := t.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// sign signs req with AWS Signature Version 4. Requests are
+// left unsigned if no credentials are configured.
+func (t *S3Target) sign(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	if t.AccessKeyID == "" || t.SecretAccessKey == "" {
+		return
+	}
+
+	var (
+		amzDate = now.UTC().Format("20060102T150405Z")
+		date    = now.UTC().Format("20060102")
+		scope   = strings.Join([]string{date, t.Region, "s3", "aws4_request"}, "/")
+	)
+
+	req.Header.Set("x-amz-date", amzDate)
+	if t.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", t.SessionToken)
+	}
+
+	req.URL.RawPath = awsURIEncode(req.URL.Path, false)
+	req.URL.RawQuery = canonicalQuery(req.URL.Query())
+
+	signedHeaders := []string{"host"}
+	for name := range req.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-amz-") || name == "content-type" {
+			signedHeaders = append(signedHeaders, name)
+		}
+	}
+	slices.Sort(signedHeaders)
+
+	canonicalHeaders := new(strings.Builder)
+	for _, name := range signedHeaders {
+		value := req.Host
+		if value == "" {
+			value = req.URL.Host
+		}
+
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, value)
+	}
+
+	var (
+		canonicalRequest = strings.Join([]string{
+			req.Method,
+			req.URL.RawPath,
+			req.URL.RawQuery,
+			canonicalHeaders.String(),
+			strings.Join(signedHeaders, ";"),
+			payloadHash,
+		}, "\n")
+		canonicalRequestHash = sha256.Sum256([]byte(canonicalRequest))
+		stringToSign         = strings.Join([]string{
+			"AWS4-HMAC-SHA256",
+			amzDate,
+			scope,
+			hex.EncodeToString(canonicalRequestHash[:]),
+		}, "\n")
+		signingKey = hmacSHA256(
+			hmacSHA256(
+				hmacSHA256(
+					hmacSHA256([]byte("AWS4"+t.SecretAccessKey), date),
+					t.Region,
+				),
+				"s3",
+			),
+			"aws4_request",
+		)
+		signature = hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for key := range q {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	parts := []string{}
+	for _, key := range keys {
+		values := q[key]
+		slices.Sort(values)
+
+		for _, value := range values {
+			parts = append(parts, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode encodes s the way AWS Signature Version 4 expects,
+// escaping everything but unreserved characters and, optionally, '/'.
+func awsURIEncode(s string, encodeSlash bool) string {
+	b := new(strings.Builder)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
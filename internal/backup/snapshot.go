@@ -0,0 +1,348 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/logutil"
+	xtar "github.com/frantjc/x/archive/tar"
+)
+
+const (
+	snapshotPrefix = "worlds-"
+	snapshotExt    = ".tar.gz"
+	// snapshotTimeLayout has millisecond precision so that snapshots
+	// taken within the same second, e.g. a scheduled one and a
+	// pre-restore one, do not overwrite each other.
+	snapshotTimeLayout = "20060102T150405.000Z"
+	// snapshotParseLayout also parses names from before they had
+	// millisecond precision, since parsing allows any fraction.
+	snapshotParseLayout = "20060102T150405Z"
+)
+
+var (
+	// DefaultSources are the subdirectories of Valheim's
+	// savedir that get snapshotted by default.
+	DefaultSources = []string{"worlds_local", "config"}
+)
+
+// Snapshot is a tarball of a Valheim savedir.
+type Snapshot struct {
+	Name   string    `json:"name"`
+	Time   time.Time `json:"time"`
+	Size   int64     `json:"size"`
+	SHA256 string    `json:"sha256,omitempty"`
+}
+
+// Retention decides which snapshots to keep. Any snapshot
+// that is one of the KeepLast most recent, the most recent of
+// one of the KeepDaily most recent days or the most recent of
+// one of the KeepWeekly most recent weeks is kept. If all of them
+// are 0, every snapshot is kept.
+type Retention struct {
+	KeepLast   int
+	KeepDaily  int
+	KeepWeekly int
+}
+
+const (
+	// DefaultRetries is the default number of times
+	// to retry shipping a snapshot to its Target.
+	DefaultRetries = 3
+)
+
+// Snapshotter takes snapshots of SaveDir and ships them to Target.
+type Snapshotter struct {
+	SaveDir   string
+	Sources   []string
+	Target    Target
+	Retention Retention
+	Retries   int
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// ParseSnapshotName returns the time that the snapshot with the given name was taken.
+func ParseSnapshotName(name string) (time.Time, error) {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotExt) {
+		return time.Time{}, fmt.Errorf("invalid snapshot name %s", name)
+	}
+
+	return time.Parse(snapshotParseLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotExt))
+}
+
+// NewSnapshotName returns the name of a snapshot taken at the given time.
+func NewSnapshotName(t time.Time) string {
+	return snapshotPrefix + t.UTC().Format(snapshotTimeLayout) + snapshotExt
+}
+
+// Compress writes a gzipped tarball of the given subdirectories
+// of savedir to w. Subdirectories that do not exist are skipped.
+func Compress(w io.Writer, savedir string, sources ...string) error {
+	gzw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		gzw = gzip.NewWriter(w)
+	}
+
+	tw := tar.NewWriter(gzw)
+
+	for _, source := range sources {
+		if err := compressSource(tw, savedir, source); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(tw.Close(), gzw.Close())
+}
+
+func compressSource(tw *tar.Writer, savedir, source string) error {
+	dir := filepath.Join(savedir, source)
+
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	rc := xtar.Compress(dir)
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		hdr.Name = path.Join(source, filepath.ToSlash(hdr.Name))
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		//nolint:gosec
+		if _, err = io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Snapshotter) sources() []string {
+	if len(s.Sources) > 0 {
+		return s.Sources
+	}
+
+	return DefaultSources
+}
+
+func (s *Snapshotter) retries() int {
+	if s.Retries > 0 {
+		return s.Retries
+	}
+
+	return DefaultRetries
+}
+
+// Snapshot takes a snapshot, ships it to Target and then prunes old ones.
+func (s *Snapshotter) Snapshot(ctx context.Context) (*Snapshot, error) {
+	var (
+		log  = logutil.SloggerFrom(ctx)
+		now  = s.now()
+		name = NewSnapshotName(now)
+	)
+
+	f, err := os.CreateTemp("", "valheimw-"+name+"-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+
+	if err := Compress(io.MultiWriter(f, hash), s.SaveDir, s.sources()...); err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{
+		Name:    name,
+		Size:    fi.Size(),
+		ModTime: now,
+		SHA256:  hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	for attempt := 0; ; attempt++ {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		if err = s.Target.Put(ctx, obj, f); err == nil {
+			break
+		} else if attempt >= s.retries() {
+			return nil, fmt.Errorf("shipping snapshot %s: %w", name, err)
+		}
+
+		backoff := time.Second << attempt
+		log.Warn("retrying shipping snapshot", "name", name, "err", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+
+	log.Info("took snapshot", "name", name, "size", obj.Size, "sha256", obj.SHA256)
+
+	return &Snapshot{Name: name, Time: now, Size: obj.Size, SHA256: obj.SHA256}, s.Prune(ctx)
+}
+
+// now returns the time to name a new snapshot after, which is
+// always later than the previous one's so that names are unique.
+func (s *Snapshotter) now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(s.last) {
+		now = s.last.Add(time.Millisecond)
+	}
+	s.last = now
+
+	return now
+}
+
+// List returns the snapshots in Target, newest first.
+func (s *Snapshotter) List(ctx context.Context) ([]Snapshot, error) {
+	objs, err := s.Target.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []Snapshot{}
+
+	for _, obj := range objs {
+		t, err := ParseSnapshotName(obj.Name)
+		if err != nil {
+			continue
+		}
+
+		snapshots = append(snapshots, Snapshot{Name: obj.Name, Time: t, Size: obj.Size, SHA256: obj.SHA256})
+	}
+
+	slices.SortFunc(snapshots, func(a, b Snapshot) int {
+		return b.Time.Compare(a.Time)
+	})
+
+	return snapshots, nil
+}
+
+// Open opens the snapshot with the given name.
+func (s *Snapshotter) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if _, err := ParseSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	return s.Target.Open(ctx, name)
+}
+
+// Prune deletes the snapshots that are not kept by Retention.
+func (s *Snapshotter) Prune(ctx context.Context) error {
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	log := logutil.SloggerFrom(ctx)
+
+	for _, snapshot := range s.Retention.Expired(snapshots) {
+		log.Info("pruning snapshot", "name", snapshot.Name)
+
+		if err := s.Target.Delete(ctx, snapshot.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Expired returns the snapshots that are not kept by r.
+// snapshots must be sorted newest first.
+func (r Retention) Expired(snapshots []Snapshot) []Snapshot {
+	if r.KeepLast <= 0 && r.KeepDaily <= 0 && r.KeepWeekly <= 0 {
+		return nil
+	}
+
+	var (
+		keep   = make([]bool, len(snapshots))
+		days   = map[string]bool{}
+		weeks  = map[string]bool{}
+		expire = []Snapshot{}
+	)
+
+	for i, snapshot := range snapshots {
+		if i < r.KeepLast {
+			keep[i] = true
+		}
+
+		day := snapshot.Time.UTC().Format(time.DateOnly)
+		if !days[day] && len(days) < r.KeepDaily {
+			days[day] = true
+			keep[i] = true
+		}
+
+		year, week := snapshot.Time.UTC().ISOWeek()
+		if w := fmt.Sprintf("%d-%d", year, week); !weeks[w] && len(weeks) < r.KeepWeekly {
+			weeks[w] = true
+			keep[i] = true
+		}
+
+		if !keep[i] {
+			expire = append(expire, snapshot)
+		}
+	}
+
+	return expire
+}
+
+// Run takes a snapshot every interval until ctx is done.
+func (s *Snapshotter) Run(ctx context.Context, interval time.Duration) error {
+	var (
+		log    = logutil.SloggerFrom(ctx)
+		ticker = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := s.Snapshot(ctx); err != nil {
+				log.Error("taking snapshot", "err", err)
+			}
+		}
+	}
+}
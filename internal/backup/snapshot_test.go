@@ -0,0 +1,162 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/backup"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	var (
+		now       = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+		snapshots = []backup.Snapshot{}
+	)
+
+	// One snapshot every 6 hours for 30 days, newest first.
+	for i := range 30 * 4 {
+		t := now.Add(-time.Duration(i) * 6 * time.Hour)
+		snapshots = append(snapshots, backup.Snapshot{Name: backup.NewSnapshotName(t), Time: t})
+	}
+
+	var (
+		retention = backup.Retention{KeepLast: 2, KeepDaily: 3, KeepWeekly: 2}
+		expired   = retention.Expired(snapshots)
+		kept      = len(snapshots) - len(expired)
+	)
+
+	// The 2 most recent, plus the newest of 2 more days (the first
+	// day is covered by KeepLast), plus the newest of 1 more week.
+	if expected := 5; kept != expected {
+		t.Fatalf("expected %d snapshots to be kept, got %d", expected, kept)
+	}
+
+	for _, i := range []int{0, 1} {
+		if slices.Contains(expired, snapshots[i]) {
+			t.Fatalf("expected snapshot %s to be kept", snapshots[i].Name)
+		}
+	}
+
+	if expired := (backup.Retention{}).Expired(snapshots); len(expired) != 0 {
+		t.Fatalf("expected no snapshots to expire, got %d", len(expired))
+	}
+}
+
+func TestSnapshotter(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		saveDir = t.TempDir()
+		s       = &backup.Snapshotter{
+			SaveDir:   saveDir,
+			Target:    &backup.DirTarget{Dir: t.TempDir()},
+			Retention: backup.Retention{KeepLast: 1},
+		}
+	)
+
+	if err := os.MkdirAll(filepath.Join(saveDir, "worlds_local"), 0755); err != nil {
+		t.Fatalf("failed to make worlds_local: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(saveDir, "worlds_local", "valheimw.fwl"), []byte("fwl"), 0644); err != nil {
+		t.Fatalf("failed to write .fwl: %v", err)
+	}
+
+	snapshot, err := s.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("failed to take snapshot: %v", err)
+	}
+
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("failed to list snapshots: %v", err)
+	}
+
+	if len(snapshots) != 1 || snapshots[0].Name != snapshot.Name {
+		t.Fatalf("expected snapshot %s, got %v", snapshot.Name, snapshots)
+	}
+
+	rc, err := s.Open(ctx, snapshot.Name)
+	if err != nil {
+		t.Fatalf("failed to open snapshot: %v", err)
+	}
+	defer rc.Close()
+
+	gzr, err := gzip.NewReader(rc)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+
+	var (
+		tr    = tar.NewReader(gzr)
+		found bool
+	)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read snapshot: %v", err)
+		}
+
+		if hdr.Name == "worlds_local/valheimw.fwl" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("expected snapshot to contain worlds_local/valheimw.fwl")
+	}
+}
+
+func TestSnapshotterUniqueNames(t *testing.T) {
+	var (
+		ctx = context.Background()
+		s   = &backup.Snapshotter{
+			SaveDir: t.TempDir(),
+			Target:  &backup.DirTarget{Dir: t.TempDir()},
+		}
+	)
+
+	// Snapshots taken within the same second, e.g. a
+	// scheduled one and a pre-restore one, are all kept.
+	for range 3 {
+		if _, err := s.Snapshot(ctx); err != nil {
+			t.Fatalf("failed to take snapshot: %v", err)
+		}
+	}
+
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("failed to list snapshots: %v", err)
+	}
+
+	if len(snapshots) != 3 {
+		t.Fatalf("expected 3 snapshots, got %v", snapshots)
+	}
+}
+
+func TestParseSnapshotName(t *testing.T) {
+	expected := time.Date(2026, 10, 17, 12, 0, 0, 123000000, time.UTC)
+
+	if actual, err := backup.ParseSnapshotName(backup.NewSnapshotName(expected)); err != nil {
+		t.Fatalf("failed to parse snapshot name: %v", err)
+	} else if !actual.Equal(expected) {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+
+	// Names from before snapshots had millisecond precision.
+	if actual, err := backup.ParseSnapshotName("worlds-20261017T120000Z.tar.gz"); err != nil {
+		t.Fatalf("failed to parse snapshot name: %v", err)
+	} else if !actual.Equal(expected.Truncate(time.Second)) {
+		t.Fatalf("expected %s, got %s", expected.Truncate(time.Second), actual)
+	}
+}
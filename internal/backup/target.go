@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Object is a file stored in a Target.
+type Object struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// SHA256 is the hex-encoded SHA-256 checksum of the object, if known.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Target is somewhere that backups can be shipped to.
+type Target interface {
+	// Put stores the contents of r as obj. Implementations must
+	// verify that the contents match obj.Size and obj.SHA256.
+	Put(ctx context.Context, obj *Object, r io.Reader) error
+	// List returns the objects in the target.
+	List(ctx context.Context) ([]Object, error)
+	// Open opens the object with the given name.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// Delete deletes the object with the given name.
+	Delete(ctx context.Context, name string) error
+}
+
+// TargetOpener opens a Target from a URL.
+type TargetOpener interface {
+	Open(context.Context, *url.URL) (Target, error)
+}
+
+var (
+	targetMux = map[string]TargetOpener{}
+)
+
+// Register registers o to open Targets for URLs with the given schemes.
+func Register(o TargetOpener, scheme string, schemes ...string) {
+	for _, s := range append(schemes, scheme) {
+		if _, ok := targetMux[s]; ok {
+			panic("attempt to reregister scheme: " + s)
+		}
+
+		targetMux[s] = o
+	}
+}
+
+// OpenTarget opens the Target for the given URL, e.g. `s3://bucket/prefix`
+// or `file:///backups`. URLs without a scheme are treated as directories.
+func OpenTarget(ctx context.Context, s string) (Target, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" {
+		u = &url.URL{Scheme: DirScheme, Path: s}
+	}
+
+	o, ok := targetMux[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, fmt.Errorf("no backup target registered for scheme %s", u.Scheme)
+	}
+
+	return o.Open(ctx, u)
+}
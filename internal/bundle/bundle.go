@@ -0,0 +1,413 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/lock"
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+const (
+	// ManifestName is the name of the Manifest at the root of a Bundle.
+	ManifestName = "manifest.json"
+	// TarName and TgzName are the names of the
+	// Bundle's files in the directory it is built in.
+	TarName = "mods.tar"
+	TgzName = "mods.tar.gz"
+	// R2zName is the name of the Bundle's profile that r2modman
+	// and Thunderstore Mod Manager can import.
+	R2zName = "mods.r2z"
+)
+
+// packageMetadata are the files that Thunderstore requires at the root of
+// every package. They are kept in the package's plugin directory so that
+// one extracted to the root of a Bundle does not collide with its Manifest.
+var packageMetadata = []string{"manifest.json", "icon.png", "README.md", "CHANGELOG.md"}
+
+// Package is a Thunderstore package in a Bundle.
+type Package struct {
+	lock.Package
+	// Dir is the directory within the Bundle that the package's
+	// files are in, the same one the server extracts it to.
+	Dir string `json:"dir"`
+}
+
+// Manifest lists what is in a Bundle so that clients
+// can tell whether they have the same mods as the server.
+type Manifest struct {
+	Packages []Package `json:"packages"`
+}
+
+// File is one of the files of a Bundle.
+type File struct {
+	Path    string
+	ETag    string
+	ModTime time.Time
+}
+
+// ServeHTTP serves the File, honoring conditional and range requests.
+func (f *File) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("ETag", f.ETag)
+
+	http.ServeContent(w, r, filepath.Base(f.Path), f.ModTime, file)
+}
+
+// Bundle is everything that a client needs in order to run the same
+// mods as the server: BepInEx, each package with all of its files and
+// the server's BepInEx config, along with a Manifest of them.
+type Bundle struct {
+	Manifest *Manifest
+	// Profile is the same mods and config as
+	// an r2modman profile, which R2z holds.
+	Profile *thunderstore.Profile
+	Tar     *File
+	Tgz     *File
+	R2z     *File
+}
+
+// BuildOpts configure Build.
+type BuildOpts struct {
+	// Client gets the packages' zips. Defaults to thunderstore.DefaultClient.
+	Client *thunderstore.Client
+	// ConfigDir is the BepInEx config directory to include, if any.
+	ConfigDir string
+	// ExcludeConfig are path.Match patterns of config files to leave out,
+	// e.g. those of server-only mods that may hold secrets. Patterns are
+	// matched case-insensitively against each file's path relative to
+	// ConfigDir, as well as its base name.
+	ExcludeConfig []string
+	// ProfileName is the name of the Bundle's Profile.
+	ProfileName string
+}
+
+// Build builds a Bundle of the given packages into dir. Every header in its
+// files is normalized so that the same packages and config always produce the
+// same bytes and, therefore, the same ETags.
+func Build(ctx context.Context, dir string, pkgs []Package, opts *BuildOpts) (*Bundle, error) {
+	o := &BuildOpts{Client: thunderstore.DefaultClient}
+	if opts != nil {
+		o.ConfigDir = opts.ConfigDir
+		o.ExcludeConfig = opts.ExcludeConfig
+		o.ProfileName = opts.ProfileName
+		if opts.Client != nil {
+			o.Client = opts.Client
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{Packages: slices.Clone(pkgs)}
+
+	for i, pkg := range manifest.Packages {
+		tsPkg := pkg.ThunderstorePackage()
+
+		pkgZip, err := o.Client.GetPackageZip(ctx, &tsPkg)
+		if err != nil {
+			return nil, err
+		}
+
+		sha256, err := pkgZip.SHA256()
+		_ = pkgZip.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		manifest.Packages[i].SHA256 = sha256
+	}
+
+	config, err := readConfig(o.ConfigDir, o.ExcludeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	modTime := time.Now()
+
+	tarFile, err := writeFile(dir, TarName, modTime, func(w io.Writer) error {
+		tw := tar.NewWriter(w)
+
+		if err := writeManifest(tw, manifest); err != nil {
+			return err
+		}
+
+		for _, pkg := range manifest.Packages {
+			if err := writePackage(ctx, tw, o.Client, &pkg); err != nil {
+				return fmt.Errorf("bundling package %s: %w", pkg.String(), err)
+			}
+		}
+
+		if err := writeConfig(tw, config); err != nil {
+			return fmt.Errorf("bundling config: %w", err)
+		}
+
+		return tw.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tgzFile, err := writeFile(dir, TgzName, modTime, func(w io.Writer) error {
+		f, err := os.Open(tarFile.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		gzw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(gzw, f); err != nil {
+			return err
+		}
+
+		return gzw.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tsPkgs := make([]thunderstore.Package, len(manifest.Packages))
+	for i, pkg := range manifest.Packages {
+		tsPkgs[i] = pkg.ThunderstorePackage()
+	}
+
+	profile, err := thunderstore.NewProfile(o.ProfileName, tsPkgs, config)
+	if err != nil {
+		return nil, err
+	}
+
+	r2zFile, err := writeFile(dir, R2zName, modTime, profile.Write)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bundle{
+		Manifest: manifest,
+		Profile:  profile,
+		Tar:      tarFile,
+		Tgz:      tgzFile,
+		R2z:      r2zFile,
+	}, nil
+}
+
+// writeFile writes the File with the given name in dir. It writes to a temporary
+// file and renames it so that concurrent readers never see a partially written one.
+func writeFile(dir, name string, modTime time.Time, write func(io.Writer) error) (*File, error) {
+	f, err := os.CreateTemp(dir, name+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+
+	if err := write(io.MultiWriter(f, h)); err != nil {
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	filePath := filepath.Join(dir, name)
+
+	if err := os.Rename(f.Name(), filePath); err != nil {
+		return nil, err
+	}
+
+	return &File{Path: filePath, ETag: etag(h), ModTime: modTime}, nil
+}
+
+func etag(h hash.Hash) string {
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(h.Sum(nil)))
+}
+
+// normalize strips everything from hdr that would
+// make identical files produce different tars.
+func normalize(hdr *tar.Header) {
+	hdr.ModTime = time.Time{}
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.Format = tar.FormatPAX
+}
+
+func writeManifest(tw *tar.Writer, manifest *Manifest) error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     ManifestName,
+		Mode:     0644,
+		Size:     int64(len(b)),
+		Format:   tar.FormatPAX,
+	}); err != nil {
+		return err
+	}
+
+	_, err = tw.Write(b)
+	return err
+}
+
+func writePackage(ctx context.Context, tw *tar.Writer, client *thunderstore.Client, pkg *Package) error {
+	tsPkg := pkg.ThunderstorePackage()
+
+	rc, err := thunderstore.Open(ctx, &tsPkg, &thunderstore.OpenOpts{Client: client})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return copyTar(tw, tar.NewReader(rc), func(name string) string {
+		if slices.Contains(packageMetadata, name) {
+			return path.Join("BepInEx/plugins", pkg.String(), name)
+		}
+
+		return path.Join(pkg.Dir, name)
+	})
+}
+
+// readConfig reads the BepInEx config files in dir that do not match
+// exclude, keyed by their slash-separated path relative to it.
+func readConfig(dir string, exclude []string) (map[string][]byte, error) {
+	config := map[string][]byte{}
+
+	if dir == "" {
+		return config, nil
+	}
+
+	if err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !d.Type().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+
+		if excluded, err := matchAny(exclude, filepath.ToSlash(rel)); err != nil || excluded {
+			return err
+		}
+
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		config[filepath.ToSlash(rel)] = b
+
+		return nil
+	}); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// matchAny reports whether name or its base name
+// matches any of patterns, case-insensitively.
+func matchAny(patterns []string, name string) (bool, error) {
+	name = strings.ToLower(name)
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+
+		for _, n := range []string{name, path.Base(name)} {
+			if matched, err := path.Match(pattern, n); err != nil {
+				return false, fmt.Errorf("invalid config exclude pattern %s: %w", pattern, err)
+			} else if matched {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func writeConfig(tw *tar.Writer, config map[string][]byte) error {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join("BepInEx/config", name),
+			Mode:     0644,
+			Size:     int64(len(config[name])),
+			Format:   tar.FormatPAX,
+		}); err != nil {
+			return err
+		}
+
+		if _, err := tw.Write(config[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyTar(tw *tar.Writer, tr *tar.Reader, rename func(string) string) error {
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// Directories are implied by the files in them and would
+		// otherwise be duplicated between packages and the config.
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		hdr.Name = rename(path.Clean(hdr.Name))
+		normalize(hdr)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		//nolint:gosec
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package bundle_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frantjc/valheimw/internal/bundle"
+	"github.com/frantjc/valheimw/internal/lock"
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+func newZip(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestBuild(t *testing.T) {
+	zips := map[string][]byte{
+		"denikson/BepInExPack_Valheim/5.4.2202": newZip(t, map[string]string{
+			"manifest.json":                           "{}",
+			"BepInExPack_Valheim/winhttp.dll":         "doorstop",
+			"BepInExPack_Valheim/BepInEx/core/a.dll":  "core",
+			"BepInExPack_Valheim/BepInEx/config/.cfg": "",
+		}),
+		"RandyKnapp/EquipmentAndQuickSlots/2.1.11": newZip(t, map[string]string{
+			"manifest.json":                     "{}",
+			"EquipmentAndQuickSlots.dll":        "plugin",
+			"Translations/English/english.json": "{}",
+		}),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := zips[strings.Trim(strings.TrimPrefix(r.URL.Path, "/package/download/"), "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse fake Thunderstore URL: %v", err)
+	}
+
+	var (
+		ctx       = context.Background()
+		dir       = t.TempDir()
+		configDir = t.TempDir()
+		opts      = &bundle.BuildOpts{
+			Client:        thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(t.TempDir())),
+			ConfigDir:     configDir,
+			ExcludeConfig: []string{"*ServerDevcommands*"},
+		}
+		pkgs = []bundle.Package{
+			{Package: lock.Package{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2202"}, Dir: "."},
+			{Package: lock.Package{Namespace: "RandyKnapp", Name: "EquipmentAndQuickSlots", VersionNumber: "2.1.11"}, Dir: "BepInEx/plugins/RandyKnapp-EquipmentAndQuickSlots-2.1.11"},
+		}
+	)
+
+	if err := os.WriteFile(filepath.Join(configDir, "randyknapp.mods.equipmentandquickslots.cfg"), []byte("EquipmentSlotsEnabled = true\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	// Config of server-only mods, which may hold secrets, is left out.
+	if err := os.WriteFile(filepath.Join(configDir, "gg.upd.serverdevcommands.cfg"), []byte("ServerDevcommands = hunter2\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	b, err := bundle.Build(ctx, dir, pkgs, opts)
+	if err != nil {
+		t.Fatalf("failed to build bundle: %v", err)
+	}
+
+	if sha256 := b.Manifest.Packages[1].SHA256; len(sha256) != 64 {
+		t.Fatalf("expected manifest to include package checksum, got %q", sha256)
+	}
+
+	f, err := os.Open(b.Tar.Path)
+	if err != nil {
+		t.Fatalf("failed to open bundle: %v", err)
+	}
+	defer f.Close()
+
+	var (
+		tr    = tar.NewReader(f)
+		names = map[string]bool{}
+	)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read bundle: %v", err)
+		}
+
+		names[hdr.Name] = true
+	}
+
+	for _, name := range []string{
+		bundle.ManifestName,
+		"winhttp.dll",
+		"BepInEx/core/a.dll",
+		"BepInEx/plugins/denikson-BepInExPack_Valheim-5.4.2202/manifest.json",
+		"BepInEx/plugins/RandyKnapp-EquipmentAndQuickSlots-2.1.11/EquipmentAndQuickSlots.dll",
+		"BepInEx/plugins/RandyKnapp-EquipmentAndQuickSlots-2.1.11/Translations/English/english.json",
+		"BepInEx/config/randyknapp.mods.equipmentandquickslots.cfg",
+	} {
+		if !names[name] {
+			t.Fatalf("expected bundle to contain %s, got %v", name, names)
+		}
+	}
+
+	// The same packages and config always produce the same bundle.
+	if names["BepInEx/config/gg.upd.serverdevcommands.cfg"] {
+		t.Fatal("expected bundle not to contain excluded config")
+	}
+
+	rebuilt, err := bundle.Build(ctx, dir, pkgs, opts)
+	if err != nil {
+		t.Fatalf("failed to rebuild bundle: %v", err)
+	}
+
+	if rebuilt.Tar.ETag != b.Tar.ETag || rebuilt.Tgz.ETag != b.Tgz.ETag {
+		t.Fatalf("expected rebuilt bundle to have the same ETags, got %s and %s", rebuilt.Tar.ETag, b.Tar.ETag)
+	}
+
+	if rebuilt.R2z.ETag != b.R2z.ETag {
+		t.Fatalf("expected rebuilt profile to have the same ETag, got %s and %s", rebuilt.R2z.ETag, b.R2z.ETag)
+	}
+
+	if len(b.Profile.Mods) != 2 || len(b.Profile.Config) != 1 {
+		t.Fatalf("expected profile with 2 mods and 1 config file, got %+v", b.Profile)
+	}
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/mods.tar", nil)
+	req.Header.Set("If-None-Match", b.Tar.ETag)
+
+	rebuilt.Tar.ServeHTTP(res, req)
+
+	if res.Code != http.StatusNotModified {
+		t.Fatalf("expected %d, got %d", http.StatusNotModified, res.Code)
+	}
+}
@@ -0,0 +1,188 @@
+package lock
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/frantjc/valheimw/steamapp"
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+const (
+	// Filename is the name of the lockfile in the Valheim savedir.
+	Filename = "valheimw.lock.json"
+)
+
+// Lockfile records exactly what was installed so
+// that subsequent installs can reproduce it.
+type Lockfile struct {
+	// Mods are the mods that were requested, e.g. via --mod.
+	// If they change, the lockfile no longer applies.
+	Mods []string `json:"mods"`
+	// Valheim is the build of the Valheim server that was installed.
+	Valheim *steamapp.AppManifest `json:"valheim,omitempty"`
+	// Packages is every Thunderstore package that
+	// the Mods resolved to, including dependencies.
+	Packages []Package `json:"packages,omitempty"`
+}
+
+// Package is a Thunderstore package pinned to an exact version.
+type Package struct {
+	Namespace     string `json:"namespace"`
+	Name          string `json:"name"`
+	VersionNumber string `json:"version_number"`
+	// SHA256 is the hex-encoded SHA-256 checksum of the package's zip.
+	SHA256     string   `json:"sha256"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+func (p *Package) String() string {
+	return fmt.Sprintf("%s-%s-%s", p.Namespace, p.Name, p.VersionNumber)
+}
+
+// NewPackage pins the given resolved Thunderstore package.
+func NewPackage(pkg *thunderstore.Package, sha256 string) Package {
+	p := Package{
+		Namespace:     pkg.Namespace,
+		Name:          pkg.Name,
+		VersionNumber: pkg.VersionNumber,
+		SHA256:        sha256,
+	}
+
+	if p.VersionNumber == "" && pkg.Latest != nil {
+		p.VersionNumber = pkg.Latest.VersionNumber
+	}
+
+	for _, communityListing := range pkg.CommunityListings {
+		for _, category := range communityListing.Categories {
+			if !slices.Contains(p.Categories, category) {
+				p.Categories = append(p.Categories, category)
+			}
+		}
+	}
+
+	return p
+}
+
+// Applies reports whether l was written for the given mods.
+func (l *Lockfile) Applies(mods []string) bool {
+	return slices.Equal(sorted(l.Mods), sorted(mods))
+}
+
+func sorted(ss []string) []string {
+	ss = slices.Clone(ss)
+	slices.Sort(ss)
+	return ss
+}
+
+// Package returns the locked Package with the given
+// namespace and name, or nil if there is not one.
+func (l *Lockfile) Package(namespace, name string) *Package {
+	for i := range l.Packages {
+		if l.Packages[i].Namespace == namespace && l.Packages[i].Name == name {
+			return &l.Packages[i]
+		}
+	}
+
+	return nil
+}
+
+// ThunderstorePackages returns the locked Packages
+// in the shape that thunderstore.DependencyTree does.
+func (l *Lockfile) ThunderstorePackages() []thunderstore.Package {
+	pkgs := make([]thunderstore.Package, len(l.Packages))
+
+	for i, p := range l.Packages {
+		pkgs[i] = p.ThunderstorePackage()
+	}
+
+	return pkgs
+}
+
+// ThunderstorePackage returns the Thunderstore package
+// that p pins, carrying its checksum so that it gets verified.
+func (p *Package) ThunderstorePackage() thunderstore.Package {
+	return thunderstore.Package{
+		Namespace:     p.Namespace,
+		Name:          p.Name,
+		VersionNumber: p.VersionNumber,
+		FullName:      p.String(),
+		SHA256:        p.SHA256,
+		CommunityListings: []thunderstore.CommunityListing{
+			{Categories: p.Categories},
+		},
+	}
+}
+
+// ErrValheimBuildMismatch is returned by CheckValheimBuild when
+// a build of the Valheim server other than the locked one is used.
+var ErrValheimBuildMismatch = errors.New("valheim server build does not match the lockfile")
+
+// CheckValheimBuild errors if buildID is not the
+// build of the Valheim server that l locks, if any.
+func (l *Lockfile) CheckValheimBuild(buildID int) error {
+	if l.Valheim != nil && l.Valheim.BuildID != buildID {
+		return fmt.Errorf("%w: locked build %d, got %d", ErrValheimBuildMismatch, l.Valheim.BuildID, buildID)
+	}
+
+	return nil
+}
+
+// Read reads the Lockfile from the given savedir.
+// If there is not one, it returns nil.
+func Read(savedir string) (*Lockfile, error) {
+	b, err := os.ReadFile(filepath.Join(savedir, Filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	l := &Lockfile{}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", Filename, err)
+	}
+
+	return l, nil
+}
+
+// Write writes l to the given savedir.
+func Write(savedir string, l *Lockfile) error {
+	if err := os.MkdirAll(savedir, 0775); err != nil {
+		return err
+	}
+
+	slices.SortFunc(l.Packages, func(a, b Package) int {
+		return cmp.Or(strings.Compare(a.Namespace, b.Namespace), strings.Compare(a.Name, b.Name))
+	})
+
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so that
+	// a crash cannot leave a partially written lockfile.
+	f, err := os.CreateTemp(savedir, Filename+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(savedir, Filename))
+}
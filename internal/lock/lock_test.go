@@ -0,0 +1,101 @@
+package lock_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/frantjc/valheimw/internal/lock"
+	"github.com/frantjc/valheimw/steamapp"
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+func TestLockfile(t *testing.T) {
+	savedir := t.TempDir()
+
+	if l, err := lock.Read(savedir); err != nil {
+		t.Fatalf("failed to read missing lockfile: %v", err)
+	} else if l != nil {
+		t.Fatalf("expected no lockfile, got %+v", l)
+	}
+
+	var (
+		bepInEx = &thunderstore.Package{
+			Namespace: "denikson",
+			Name:      "BepInExPack_Valheim",
+			Latest:    &thunderstore.Latest{VersionNumber: "5.4.2202"},
+		}
+		mod = &thunderstore.Package{
+			Namespace:     "RandyKnapp",
+			Name:          "EquipmentAndQuickSlots",
+			VersionNumber: "2.1.11",
+			CommunityListings: []thunderstore.CommunityListing{
+				{Categories: []string{"Server-side", "Client-side"}},
+				{Categories: []string{"Server-side"}},
+			},
+		}
+		expected = &lock.Lockfile{
+			Mods:    []string{"RandyKnapp/EquipmentAndQuickSlots"},
+			Valheim: &steamapp.AppManifest{BuildID: 19876543, Depots: map[string]string{"896661": "1234567890123456789"}},
+			Packages: []lock.Package{
+				lock.NewPackage(mod, "b"),
+				lock.NewPackage(bepInEx, "a"),
+			},
+		}
+	)
+
+	if err := lock.Write(savedir, expected); err != nil {
+		t.Fatalf("failed to write lockfile: %v", err)
+	}
+
+	l, err := lock.Read(savedir)
+	if err != nil {
+		t.Fatalf("failed to read lockfile: %v", err)
+	}
+
+	if !l.Applies([]string{"RandyKnapp/EquipmentAndQuickSlots"}) {
+		t.Fatal("expected lockfile to apply to the same mods")
+	}
+
+	if l.Applies([]string{"RandyKnapp/EquipmentAndQuickSlots", "Azumatt/AzuCraftyBoxes"}) {
+		t.Fatal("expected lockfile not to apply to different mods")
+	}
+
+	if l.Valheim == nil || l.Valheim.BuildID != 19876543 {
+		t.Fatalf("expected Valheim build 19876543, got %+v", l.Valheim)
+	}
+
+	p := l.Package("denikson", "BepInExPack_Valheim")
+	if p == nil || p.VersionNumber != "5.4.2202" || p.SHA256 != "a" {
+		t.Fatalf("expected locked BepInEx 5.4.2202, got %+v", p)
+	}
+
+	pkgs := l.ThunderstorePackages()
+	if len(pkgs) != 2 {
+		t.Fatalf("expected 2 packages, got %d", len(pkgs))
+	}
+
+	// Packages are sorted by namespace and then name.
+	if pkgs[0].String() != "RandyKnapp-EquipmentAndQuickSlots-2.1.11" {
+		t.Fatalf("expected RandyKnapp-EquipmentAndQuickSlots-2.1.11, got %s", pkgs[0].String())
+	}
+
+	if categories := pkgs[0].CommunityListings[0].Categories; len(categories) != 2 {
+		t.Fatalf("expected 2 unique categories, got %v", categories)
+	}
+}
+
+func TestLockfileCheckValheimBuild(t *testing.T) {
+	l := &lock.Lockfile{Valheim: &steamapp.AppManifest{BuildID: 19876543}}
+
+	if err := l.CheckValheimBuild(19876543); err != nil {
+		t.Fatalf("expected locked build to match, got %v", err)
+	}
+
+	if err := l.CheckValheimBuild(20000000); !errors.Is(err, lock.ErrValheimBuildMismatch) {
+		t.Fatalf("expected %v, got %v", lock.ErrValheimBuildMismatch, err)
+	}
+
+	if err := (&lock.Lockfile{}).CheckValheimBuild(20000000); err != nil {
+		t.Fatalf("expected any build to match a lockfile without one, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Package metrics exposes valheimw's Prometheus metrics.
+// Every one of them is prefixed with valheimw_.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/frantjc/valheimw/thunderstore"
+	"github.com/frantjc/valheimw/valheim"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "valheimw"
+	// serverSubsystem is for metrics about the Valheim server process itself.
+	serverSubsystem = "server"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	InstallDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "install_duration_seconds",
+		Help:      "How long it took to install each component, e.g. the Valheim server or a Thunderstore package.",
+	}, []string{"component"})
+
+	ThunderstoreDownloadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "thunderstore",
+		Name:      "download_bytes_total",
+		Help:      "Number of bytes of Thunderstore package zips downloaded.",
+	})
+
+	ThunderstoreCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "thunderstore",
+		Name:      "cache_hits_total",
+		Help:      "Number of Thunderstore package zips found in the cache.",
+	})
+
+	ThunderstoreCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "thunderstore",
+		Name:      "cache_misses_total",
+		Help:      "Number of Thunderstore package zips that had to be downloaded.",
+	})
+
+	WorldSaveDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "world_save_duration_seconds",
+		Help:      "How long the Valheim server took to save the world.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+
+	WorldDay = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "world_day",
+		Help:      "The in-game day that the world is on.",
+	})
+)
+
+// Handler serves the metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentHandler counts the requests served by h as the given route.
+func InstrumentHandler(route string, h http.Handler) http.Handler {
+	return promhttp.InstrumentHandlerCounter(HTTPRequests.MustCurryWith(prometheus.Labels{"route": route}), h)
+}
+
+// ObserveInstall records how long it took to install the given component since start.
+func ObserveInstall(component string, start time.Time) {
+	InstallDuration.WithLabelValues(component).Set(time.Since(start).Seconds())
+}
+
+type thunderstoreObserver struct{}
+
+func (thunderstoreObserver) CacheHit(*thunderstore.Package) {
+	ThunderstoreCacheHits.Inc()
+}
+
+func (thunderstoreObserver) Downloaded(_ *thunderstore.Package, n int64) {
+	ThunderstoreCacheMisses.Inc()
+	ThunderstoreDownloadBytes.Add(float64(n))
+}
+
+var (
+	// ThunderstoreObserver collects metrics about a thunderstore.Client.
+	ThunderstoreObserver thunderstore.Observer = thunderstoreObserver{}
+)
+
+// MustRegisterServer registers metrics about the given Valheim server,
+// its players and its world in savedir.
+func MustRegisterServer(server *valheim.Server, roster *valheim.Roster, savedir, world string) {
+	prometheus.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{
+			Namespace: namespace + "_" + serverSubsystem,
+			PidFn: func() (int, error) {
+				if pid := server.Status().PID; pid > 0 {
+					return pid, nil
+				}
+
+				return 0, errors.New("valheim server is not running")
+			},
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: serverSubsystem,
+			Name:      "up",
+			Help:      "Whether the Valheim server is ready.",
+		}, func() float64 {
+			if server.Status().Ready {
+				return 1
+			}
+
+			return 0
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: serverSubsystem,
+			Name:      "restarts_total",
+			Help:      "Number of times the Valheim server was restarted after crashing.",
+		}, func() float64 {
+			return float64(server.Status().Restarts)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "players_online",
+			Help:      "Number of players connected to the Valheim server.",
+		}, func() float64 {
+			return float64(len(roster.Players()))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "world_size_bytes",
+			Help:      "Size of the world's .db file.",
+		}, func() float64 {
+			fi, err := os.Stat(filepath.Join(savedir, "worlds_local", world+".db"))
+			if err != nil {
+				return 0
+			}
+
+			return float64(fi.Size())
+		}),
+	)
+}
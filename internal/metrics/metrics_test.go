@@ -0,0 +1,87 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/metrics"
+	"github.com/frantjc/valheimw/valheim"
+)
+
+func scrape(t *testing.T) string {
+	res := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected %d scraping metrics, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+
+	return string(b)
+}
+
+func expectMetric(t *testing.T, body, metric string) {
+	for _, line := range strings.Split(body, "\n") {
+		if line == metric {
+			return
+		}
+	}
+
+	t.Fatalf("expected metrics to include %q, got:\n%s", metric, body)
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	h := metrics.InstrumentHandler("/teapot", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for range 2 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/teapot", nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/teapot", nil))
+
+	body := scrape(t)
+
+	expectMetric(t, body, `valheimw_http_requests_total{code="418",method="get",route="/teapot"} 2`)
+	expectMetric(t, body, `valheimw_http_requests_total{code="418",method="post",route="/teapot"} 1`)
+}
+
+func TestMustRegisterServer(t *testing.T) {
+	var (
+		savedir = t.TempDir()
+		roster  = valheim.NewRoster(savedir)
+	)
+
+	if err := os.MkdirAll(filepath.Join(savedir, "worlds_local"), 0755); err != nil {
+		t.Fatalf("failed to create worlds: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(savedir, "worlds_local", "Dedicated.db"), make([]byte, 1234), 0644); err != nil {
+		t.Fatalf("failed to write .db: %v", err)
+	}
+
+	for _, platformID := range []string{"Steam_1", "Steam_2"} {
+		if err := roster.Handle(valheim.Event{Type: valheim.EventPlayerConnected, Time: time.Now(), PlatformID: platformID}); err != nil {
+			t.Fatalf("failed to handle event: %v", err)
+		}
+	}
+
+	metrics.MustRegisterServer(&valheim.Server{}, roster, savedir, "Dedicated")
+
+	body := scrape(t)
+
+	expectMetric(t, body, "valheimw_server_up 0")
+	expectMetric(t, body, "valheimw_server_restarts_total 0")
+	expectMetric(t, body, "valheimw_players_online 2")
+	expectMetric(t, body, "valheimw_world_size_bytes 1234")
+}
@@ -0,0 +1,461 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/logutil"
+	"golang.org/x/time/rate"
+)
+
+// EventType is the kind of thing that an Event describes.
+type EventType string
+
+const (
+	EventServerStarted   EventType = "server_started"
+	EventServerStopped   EventType = "server_stopped"
+	EventServerCrashed   EventType = "server_crashed"
+	EventPlayerJoined    EventType = "player_joined"
+	EventPlayerLeft      EventType = "player_left"
+	EventBossDefeated    EventType = "boss_defeated"
+	EventUpdateAvailable EventType = "update_available"
+)
+
+// Event is something that happened to the Valheim server
+// that is worth notifying webhooks about.
+type Event struct {
+	Type    EventType `json:"type"`
+	Time    time.Time `json:"time"`
+	Server  string    `json:"server,omitempty"`
+	Message string    `json:"message"`
+	// Player is the character name of the player
+	// that joined or left, if it is known.
+	Player     string `json:"player,omitempty"`
+	PlatformID string `json:"platformId,omitempty"`
+	Boss       string `json:"boss,omitempty"`
+	Error      string `json:"error,omitempty"`
+	BuildID    string `json:"buildId,omitempty"`
+}
+
+func (e *Event) message() string {
+	if e.Message != "" {
+		return e.Message
+	}
+
+	player := e.Player
+	if player == "" {
+		player = e.PlatformID
+	}
+
+	switch e.Type {
+	case EventServerStarted:
+		return "Server started"
+	case EventServerStopped:
+		return "Server stopped"
+	case EventServerCrashed:
+		if e.Error != "" {
+			return fmt.Sprintf("Server crashed: %s", e.Error)
+		}
+
+		return "Server crashed"
+	case EventPlayerJoined:
+		return fmt.Sprintf("%s joined", player)
+	case EventPlayerLeft:
+		return fmt.Sprintf("%s left", player)
+	case EventBossDefeated:
+		return fmt.Sprintf("%s was defeated", e.Boss)
+	case EventUpdateAvailable:
+		return fmt.Sprintf("Update available: build %s", e.BuildID)
+	}
+
+	return string(e.Type)
+}
+
+// Format is the shape of the body that gets POSTed to a Webhook.
+type Format string
+
+const (
+	// FormatJSON POSTs the Event itself.
+	FormatJSON Format = "json"
+	// FormatDiscord POSTs a Discord webhook message.
+	FormatDiscord Format = "discord"
+)
+
+// Webhook is a URL to POST Events to.
+type Webhook struct {
+	URL    string
+	Format Format
+	// Events are the types of Events to POST.
+	// If empty, every Event is POSTed.
+	Events []EventType
+}
+
+func (w *Webhook) wants(event *Event) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event.Type)
+}
+
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color,omitempty"`
+	Timestamp   string `json:"timestamp,omitempty"`
+}
+
+var discordColors = map[EventType]int{
+	EventServerStarted:   0x2ecc71,
+	EventServerStopped:   0x95a5a6,
+	EventServerCrashed:   0xe74c3c,
+	EventPlayerJoined:    0x3498db,
+	EventPlayerLeft:      0x7f8c8d,
+	EventBossDefeated:    0xf1c40f,
+	EventUpdateAvailable: 0x9b59b6,
+}
+
+const (
+	maxDiscordTitleLength = 256
+)
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+
+	return s
+}
+
+func (w *Webhook) body(event *Event) ([]byte, error) {
+	switch w.Format {
+	case FormatDiscord:
+		return json.Marshal(&discordMessage{
+			Username: event.Server,
+			Embeds: []discordEmbed{
+				{
+					Title:     truncate(event.Message, maxDiscordTitleLength),
+					Color:     discordColors[event.Type],
+					Timestamp: event.Time.UTC().Format(time.RFC3339),
+				},
+			},
+		})
+	case FormatJSON, "":
+		return json.Marshal(event)
+	}
+
+	return nil, fmt.Errorf("unknown webhook format %s", w.Format)
+}
+
+const (
+	// DefaultRetries is the default number of times
+	// to retry POSTing an Event to a Webhook.
+	DefaultRetries = 3
+	// DefaultQueueSize is the default number of Events
+	// that can be waiting to be POSTed to each Webhook
+	// before new ones get dropped.
+	DefaultQueueSize = 64
+)
+
+var (
+	// DefaultLimit is the default rate at which Events are POSTed
+	// to each Webhook. It is well within Discord's rate limits.
+	DefaultLimit = rate.Every(2 * time.Second)
+	// DefaultBurst is the default number of Events that
+	// can be POSTed to each Webhook at once.
+	DefaultBurst = 5
+)
+
+// Notifier POSTs Events to Webhooks in the background, retrying
+// with backoff and rate-limiting each Webhook independently
+// so that a slow or failing one does not hold up the others.
+type Notifier struct {
+	Webhooks   []Webhook
+	HTTPClient *http.Client
+	Retries    int
+	Limit      rate.Limit
+	Burst      int
+	// Backoff is how long to wait before the first retry.
+	// It doubles with each subsequent one.
+	Backoff time.Duration
+
+	once   sync.Once
+	queues []chan Event
+	// done is closed when Run returns.
+	done chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	cancel context.CancelFunc
+}
+
+func (n *Notifier) init() {
+	n.once.Do(func() {
+		n.queues = make([]chan Event, len(n.Webhooks))
+		for i := range n.queues {
+			n.queues[i] = make(chan Event, DefaultQueueSize)
+		}
+		n.done = make(chan struct{})
+	})
+}
+
+func (n *Notifier) httpClient() *http.Client {
+	if n.HTTPClient != nil {
+		return n.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func (n *Notifier) retries() int {
+	if n.Retries > 0 {
+		return n.Retries
+	}
+
+	return DefaultRetries
+}
+
+func (n *Notifier) backoff() time.Duration {
+	if n.Backoff > 0 {
+		return n.Backoff
+	}
+
+	return time.Second
+}
+
+func (n *Notifier) limiter() *rate.Limiter {
+	limit, burst := n.Limit, n.Burst
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	if burst <= 0 {
+		burst = DefaultBurst
+	}
+
+	return rate.NewLimiter(limit, burst)
+}
+
+// Notify queues event to be POSTed to each
+// Webhook that wants it by Run. It does not block;
+// if a Webhook's queue is full or Shutdown has
+// been called, the Event is dropped.
+func (n *Notifier) Notify(ctx context.Context, event Event) {
+	n.init()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		logutil.SloggerFrom(ctx).Warn("dropping webhook event: notifier is shut down", "type", event.Type)
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	event.Message = event.message()
+
+	for i, webhook := range n.Webhooks {
+		if !webhook.wants(&event) {
+			continue
+		}
+
+		select {
+		case n.queues[i] <- event:
+		default:
+			logutil.SloggerFrom(ctx).Warn("dropping webhook event: queue is full", "type", event.Type)
+		}
+	}
+}
+
+// Run POSTs queued Events to Webhooks until ctx is done or, after
+// Shutdown is called, until every Event queued before it has been POSTed.
+// It must only be called once.
+func (n *Notifier) Run(ctx context.Context) error {
+	n.init()
+	defer close(n.done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	n.mu.Lock()
+	n.cancel = cancel
+	n.mu.Unlock()
+
+	var (
+		log = logutil.SloggerFrom(ctx)
+		wg  sync.WaitGroup
+	)
+
+	for i := range n.Webhooks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var (
+				webhook = &n.Webhooks[i]
+				limiter = n.limiter()
+			)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event, ok := <-n.queues[i]:
+					if !ok {
+						return
+					}
+
+					if err := limiter.Wait(ctx); err != nil {
+						return
+					}
+
+					if err := n.Post(ctx, webhook, &event); err != nil {
+						log.Error("posting webhook event", "type", event.Type, "err", err)
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return nil
+	}
+
+	return ctx.Err()
+}
+
+// Shutdown stops queueing Events and waits for Run to POST the
+// ones that are already queued and return. If ctx is done first,
+// Run gives up on the rest and Shutdown returns ctx's error.
+func (n *Notifier) Shutdown(ctx context.Context) error {
+	n.init()
+
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		for _, queue := range n.queues {
+			close(queue)
+		}
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		n.mu.Lock()
+		if n.cancel != nil {
+			n.cancel()
+		}
+		n.mu.Unlock()
+
+		return ctx.Err()
+	}
+}
+
+// retryableError is an error that is worth retrying,
+// optionally after a duration that the server asked for.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Post POSTs event to webhook, retrying with backoff if the
+// request fails in a way that might succeed if tried again.
+func (n *Notifier) Post(ctx context.Context, webhook *Webhook, event *Event) error {
+	event.Message = event.message()
+
+	body, err := webhook.body(event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := n.post(ctx, webhook, body)
+		if err == nil {
+			return nil
+		}
+
+		retryable := &retryableError{}
+		if !errors.As(err, &retryable) || attempt >= n.retries() {
+			return err
+		}
+
+		backoff := n.backoff() << attempt
+		if retryable.after > 0 {
+			backoff = retryable.after
+		}
+
+		logutil.SloggerFrom(ctx).Warn("retrying webhook event", "type", event.Type, "err", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, webhook *Webhook, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.httpClient().Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	err = fmt.Errorf("webhook responded %s: %s", res.Status, strings.TrimSpace(string(b)))
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		after := time.Duration(0)
+		if seconds, err := strconv.ParseFloat(res.Header.Get("Retry-After"), 64); err == nil {
+			after = time.Duration(seconds * float64(time.Second))
+		}
+
+		return &retryableError{err: err, after: after}
+	case res.StatusCode >= 500:
+		return &retryableError{err: err}
+	}
+
+	return err
+}
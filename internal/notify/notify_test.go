@@ -0,0 +1,205 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/notify"
+)
+
+// receiver records the bodies POSTed to it, responding
+// with the given status codes before succeeding.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []map[string]any
+	received chan struct{}
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0.01")
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	body := map[string]any{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(http.StatusNoContent)
+	r.received <- struct{}{}
+}
+
+func TestNotifier(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		jsonRecv    = &receiver{statuses: []int{http.StatusServiceUnavailable}, received: make(chan struct{}, 8)}
+		discordRecv = &receiver{statuses: []int{http.StatusTooManyRequests}, received: make(chan struct{}, 8)}
+		jsonSrv     = httptest.NewServer(jsonRecv)
+		discordSrv  = httptest.NewServer(discordRecv)
+		n           = &notify.Notifier{
+			Webhooks: []notify.Webhook{
+				{URL: jsonSrv.URL, Format: notify.FormatJSON},
+				{URL: discordSrv.URL, Format: notify.FormatDiscord, Events: []notify.EventType{notify.EventBossDefeated}},
+			},
+			Backoff: 10 * time.Millisecond,
+		}
+		errC = make(chan error, 1)
+	)
+	defer cancel()
+	t.Cleanup(jsonSrv.Close)
+	t.Cleanup(discordSrv.Close)
+
+	go func() {
+		errC <- n.Run(ctx)
+	}()
+
+	n.Notify(ctx, notify.Event{Type: notify.EventPlayerJoined, Server: "valheimw", Player: "Ragnar"})
+	n.Notify(ctx, notify.Event{Type: notify.EventBossDefeated, Server: "valheimw", Boss: "Eikthyr"})
+
+	for _, received := range []chan struct{}{jsonRecv.received, jsonRecv.received, discordRecv.received} {
+		select {
+		case <-received:
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for webhook")
+		}
+	}
+
+	cancel()
+	<-errC
+
+	if len(jsonRecv.bodies) != 2 {
+		t.Fatalf("expected 2 JSON webhooks, got %d", len(jsonRecv.bodies))
+	}
+
+	if message := jsonRecv.bodies[0]["message"]; message != "Ragnar joined" {
+		t.Fatalf("expected message %q, got %q", "Ragnar joined", message)
+	}
+
+	if len(discordRecv.bodies) != 1 {
+		t.Fatalf("expected 1 Discord webhook, got %d", len(discordRecv.bodies))
+	}
+
+	embeds, _ := discordRecv.bodies[0]["embeds"].([]any)
+	if len(embeds) != 1 {
+		t.Fatalf("expected 1 Discord embed, got %d", len(embeds))
+	}
+
+	if title := embeds[0].(map[string]any)["title"]; title != "Eikthyr was defeated" {
+		t.Fatalf("expected title %q, got %q", "Eikthyr was defeated", title)
+	}
+}
+
+func TestNotifierShutdown(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		recv = &receiver{received: make(chan struct{}, 8)}
+		srv  = httptest.NewServer(recv)
+		n    = &notify.Notifier{
+			Webhooks: []notify.Webhook{{URL: srv.URL, Format: notify.FormatJSON}},
+		}
+		errC = make(chan error, 1)
+	)
+	t.Cleanup(srv.Close)
+
+	// Events queued before Shutdown, e.g. the Valheim
+	// server stopping, are POSTed even if Run has not
+	// gotten to them yet.
+	n.Notify(ctx, notify.Event{Type: notify.EventPlayerLeft, Server: "valheimw", Player: "Ragnar"})
+	n.Notify(ctx, notify.Event{Type: notify.EventServerStopped, Server: "valheimw"})
+
+	go func() {
+		errC <- n.Run(ctx)
+	}()
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := n.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("failed to shut down notifier: %v", err)
+	}
+
+	if err := <-errC; err != nil {
+		t.Fatalf("expected notifier to finish running, got %v", err)
+	}
+
+	// Events queued after Shutdown are dropped.
+	n.Notify(ctx, notify.Event{Type: notify.EventServerStarted, Server: "valheimw"})
+
+	if len(recv.bodies) != 2 {
+		t.Fatalf("expected 2 webhooks, got %d", len(recv.bodies))
+	}
+
+	if message := recv.bodies[1]["message"]; message != "Server stopped" {
+		t.Fatalf("expected message %q, got %q", "Server stopped", message)
+	}
+}
+
+func TestNotifierShutdownTimeout(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		blocked = make(chan struct{})
+		srv     = httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			<-blocked
+		}))
+		n = &notify.Notifier{
+			Webhooks: []notify.Webhook{{URL: srv.URL, Format: notify.FormatJSON}},
+		}
+		errC = make(chan error, 1)
+	)
+	t.Cleanup(srv.Close)
+	defer close(blocked)
+
+	n.Notify(ctx, notify.Event{Type: notify.EventServerStopped, Server: "valheimw"})
+
+	go func() {
+		errC <- n.Run(ctx)
+	}()
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if err := n.Shutdown(shutdownCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v shutting down notifier, got %v", context.DeadlineExceeded, err)
+	}
+
+	select {
+	case <-errC:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for notifier to give up")
+	}
+}
+
+func TestNotifierPostDoesNotRetryClientErrors(t *testing.T) {
+	var (
+		recv = &receiver{statuses: []int{http.StatusBadRequest}, received: make(chan struct{}, 1)}
+		srv  = httptest.NewServer(recv)
+		n    = &notify.Notifier{Backoff: time.Millisecond}
+	)
+	t.Cleanup(srv.Close)
+
+	if err := n.Post(context.Background(), &notify.Webhook{URL: srv.URL}, &notify.Event{Type: notify.EventServerStarted}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(recv.bodies) != 0 {
+		t.Fatalf("expected no retries, got %d", len(recv.bodies))
+	}
+}
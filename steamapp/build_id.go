@@ -0,0 +1,96 @@
+package steamapp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/frantjc/go-steamcmd"
+	"github.com/frantjc/valheimw/internal/appinfoutil"
+)
+
+// BuildID returns the ID of the latest build of the given
+// Steamapp's branch, e.g. to check if an update is available.
+func BuildID(ctx context.Context, appID int, opts ...OpenOpt) (int, error) {
+	o := &OpenOpts{
+		PlatformType: steamcmd.DefaultPlatformType,
+	}
+
+	for _, opt := range opts {
+		opt.Apply(o)
+	}
+
+	appInfo, err := appinfoutil.GetAppInfo(ctx, appID,
+		appinfoutil.WithLogin(o.Login.Username, o.Login.Password, o.Login.SteamGuardCode),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	branchName := o.getBranchName()
+
+	branch, ok := appInfo.Depots.Branches[branchName]
+	if !ok {
+		return 0, fmt.Errorf("branch %s not found", branchName)
+	}
+
+	return branch.BuildID, nil
+}
+
+var (
+	buildIDRegexp         = regexp.MustCompile(`"buildid"\s+"(\d+)"`)
+	installedDepotsRegexp = regexp.MustCompile(`"InstalledDepots"\s*\{((?:\s*"\d+"\s*\{[^{}]*\})*)\s*\}`)
+	depotManifestRegexp   = regexp.MustCompile(`"(\d+)"\s*\{[^{}]*"manifest"\s+"(\d+)"[^{}]*\}`)
+)
+
+// AppManifest is the part of the app manifest that steamcmd leaves
+// behind that describes exactly which build of a Steamapp is installed.
+type AppManifest struct {
+	BuildID int `json:"buildId"`
+	// Depots maps the ID of each installed depot
+	// to the ID of the manifest that was installed.
+	Depots map[string]string `json:"depots,omitempty"`
+}
+
+// ReadAppManifest reads the AppManifest of the given
+// Steamapp that is installed in dir.
+func ReadAppManifest(dir string, appID int) (*AppManifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "steamapps", fmt.Sprintf("appmanifest_%d.acf", appID)))
+	if err != nil {
+		return nil, err
+	}
+
+	matches := buildIDRegexp.FindSubmatch(b)
+	if matches == nil {
+		return nil, fmt.Errorf("steamapp %d app manifest does not contain a build ID", appID)
+	}
+
+	buildID, err := strconv.Atoi(string(matches[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	appManifest := &AppManifest{BuildID: buildID, Depots: map[string]string{}}
+
+	if matches = installedDepotsRegexp.FindSubmatch(b); matches != nil {
+		for _, depot := range depotManifestRegexp.FindAllSubmatch(matches[1], -1) {
+			appManifest.Depots[string(depot[1])] = string(depot[2])
+		}
+	}
+
+	return appManifest, nil
+}
+
+// InstalledBuildID returns the ID of the build of
+// the given Steamapp that is installed in dir.
+func InstalledBuildID(dir string, appID int) (int, error) {
+	appManifest, err := ReadAppManifest(dir, appID)
+	if err != nil {
+		return 0, err
+	}
+
+	return appManifest.BuildID, nil
+}
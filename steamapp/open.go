@@ -40,12 +40,15 @@ func (o *OpenOpts) Apply(opts *OpenOpts) {
 	opts.LaunchType = o.LaunchType
 }
 
-func (o *OpenOpts) getInstallDir(appID int) string {
-	branchName := DefaultBranchName
+func (o *OpenOpts) getBranchName() string {
 	if o.Beta != "" {
-		branchName = o.Beta
+		return o.Beta
 	}
-	return filepath.Join(cache.Dir, Scheme, o.PlatformType.String(), fmt.Sprint(appID), branchName)
+	return DefaultBranchName
+}
+
+func (o *OpenOpts) getInstallDir(appID int) string {
+	return filepath.Join(cache.Dir, Scheme, o.PlatformType.String(), fmt.Sprint(appID), o.getBranchName())
 }
 
 type OpenOpt interface {
@@ -98,10 +101,7 @@ func Open(ctx context.Context, appID int, opts ...OpenOpt) (io.ReadCloser, error
 		return nil, err
 	}
 
-	branchName := DefaultBranchName
-	if o.Beta != "" {
-		branchName = o.Beta
-	}
+	branchName := o.getBranchName()
 
 	branch, ok := appInfo.Depots.Branches[branchName]
 	if !ok {
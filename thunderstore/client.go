@@ -1,7 +1,10 @@
 package thunderstore
 
 import (
+	"archive/zip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/frantjc/valheimw/internal/cache"
 )
@@ -46,8 +50,32 @@ func WithURL(u *url.URL) ClientOpt {
 	}
 }
 
+// Observer is notified when a Client gets a package's zip,
+// e.g. to collect metrics about it.
+type Observer interface {
+	// CacheHit is called when a package's zip is already cached.
+	CacheHit(*Package)
+	// Downloaded is called with the number of bytes of
+	// a package's zip that were downloaded to the cache.
+	Downloaded(*Package, int64)
+}
+
+func WithObserver(observer Observer) ClientOpt {
+	return func(c *Client) {
+		c.observer = observer
+	}
+}
+
+// WithOffline makes the Client only use package metadata and
+// zips that it has cached instead of making any requests.
+func WithOffline(offline bool) ClientOpt {
+	return func(c *Client) {
+		c.offline = offline
+	}
+}
+
 func NewClient(opts ...ClientOpt) *Client {
-	c := &Client{DefaultURL, http.DefaultClient, filepath.Join(cache.Dir, Scheme)}
+	c := &Client{DefaultURL, http.DefaultClient, filepath.Join(cache.Dir, Scheme), nil, false, "", ""}
 
 	for _, opt := range opts {
 		opt(c)
@@ -60,19 +88,111 @@ type Client struct {
 	thunderstoreURL *url.URL
 	httpClient      *http.Client
 	dir             string
+	observer        Observer
+	offline         bool
+	community       string
+	bepInExPack     string
 }
 
-func (c *Client) GetPackage(ctx context.Context, p *Package) (*Package, error) {
-	req, err := http.NewRequestWithContext(
-		ctx, http.MethodGet,
-		fmt.Sprintf("%s/", c.thunderstoreURL.JoinPath("/api/experimental/package", p.Namespace, p.Name, p.VersionNumber).String()),
-		nil,
-	)
+const (
+	// maxPackageSize is the most that a package's metadata can be.
+	maxPackageSize = 4 << 20
+	// maxListingSize is the most that a community's listing can be. The largest
+	// communities' listings, e.g. valheim's, are tens of megabytes.
+	maxListingSize = 256 << 20
+)
+
+// errNotCached is returned when something that is
+// not cached is requested while the client is offline.
+var errNotCached = errors.New("not cached and the client is offline")
+
+// cachedResponse is a response from Thunderstore's
+// API along with what is needed to revalidate it.
+type cachedResponse struct {
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	Body         json.RawMessage `json:"body"`
+}
+
+func (c *Client) packagePath(p *Package) string {
+	version := p.VersionNumber
+	if version == "" {
+		version = "latest"
+	}
+
+	return filepath.Join(c.dir, "metadata", p.Namespace, p.Name, version+".json")
+}
+
+func readCachedResponse(name string) *cachedResponse {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+
+	cached := &cachedResponse{}
+	if err := json.Unmarshal(b, cached); err != nil {
+		return nil
+	}
+
+	return cached
+}
+
+func writeCachedResponse(name string, cached *cachedResponse) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so that concurrent
+	// readers never see a partially written one.
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+// getCached gets the JSON body at u, caching it on disk at name once validate
+// accepts it. If immutable, a cached body is used as-is. Otherwise, it is
+// revalidated via its ETag and Last-Modified headers unless the client is offline.
+// Bodies larger than maxSize are rejected rather than read into memory.
+func (c *Client) getCached(ctx context.Context, u, name string, immutable bool, maxSize int64, validate func([]byte) error) ([]byte, error) {
+	cached := readCachedResponse(name)
+	if cached != nil && (immutable || c.offline) {
+		return cached.Body, nil
+	} else if c.offline {
+		return nil, errNotCached
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	pkg := &Package{}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
 	res, err := c.httpClient.Do(req)
 	if err != nil {
@@ -80,7 +200,40 @@ func (c *Client) GetPackage(ctx context.Context, p *Package) (*Package, error) {
 	}
 	defer res.Body.Close()
 
-	if err := json.NewDecoder(res.Body).Decode(pkg); err != nil {
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		return cached.Body, nil
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > maxSize {
+		return nil, fmt.Errorf("response from %s exceeds %d bytes", u, maxSize)
+	}
+
+	if err := validate(b); err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusOK {
+		// The cache is only an optimization, so
+		// failing to write to it is not fatal.
+		_ = writeCachedResponse(name, &cachedResponse{
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+			Body:         b,
+		})
+	}
+
+	return b, nil
+}
+
+func decodePackage(p *Package, b []byte) (*Package, error) {
+	pkg := &Package{}
+
+	if err := json.Unmarshal(b, pkg); err != nil {
 		return nil, err
 	}
 
@@ -91,6 +244,38 @@ func (c *Client) GetPackage(ctx context.Context, p *Package) (*Package, error) {
 	return pkg, nil
 }
 
+// GetPackage gets the metadata of the given package, caching it on disk. Because
+// a package version never changes once it is published, cached metadata for one
+// is used as-is, whereas cached metadata for the latest version of a package is
+// revalidated via its ETag and Last-Modified headers.
+func (c *Client) GetPackage(ctx context.Context, p *Package) (*Package, error) {
+	b, err := c.getCached(
+		ctx,
+		fmt.Sprintf("%s/", c.thunderstoreURL.JoinPath("/api/experimental/package", p.Namespace, p.Name, p.VersionNumber).String()),
+		c.packagePath(p),
+		p.VersionNumber != "",
+		maxPackageSize,
+		func(b []byte) error {
+			_, err := decodePackage(p, b)
+			return err
+		},
+	)
+	if errors.Is(err, errNotCached) {
+		return nil, fmt.Errorf("package %s: %w", p, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	pkg, err := decodePackage(p, b)
+	if err != nil {
+		return nil, err
+	}
+
+	c.filterCommunityListings(pkg)
+
+	return pkg, nil
+}
+
 type ZipReadableCloser struct {
 	f    *os.File
 	size int64
@@ -112,19 +297,94 @@ func (z *ZipReadableCloser) Remove() error {
 	return os.Remove(z.f.Name())
 }
 
+// SHA256 returns the hex-encoded SHA-256 checksum of the zip.
+func (z *ZipReadableCloser) SHA256() (string, error) {
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, io.NewSectionReader(z.f, 0, z.size)); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ChecksumError is returned when a package's
+// zip does not have the expected checksum.
+type ChecksumError struct {
+	Package  string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("package %s zip has sha256 %s, but expected %s", e.Package, e.Actual, e.Expected)
+}
+
+// verifyZip checks that f is a readable zip
+// and, if sha256 is set, that it matches it.
+func verifyZip(p *Package, f *os.File, size int64, sha256 string) error {
+	z := &ZipReadableCloser{f, size}
+
+	if _, err := zip.NewReader(z, size); err != nil {
+		return fmt.Errorf("package %s zip is corrupt: %w", p, err)
+	}
+
+	if sha256 != "" {
+		actual, err := z.SHA256()
+		if err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(actual, sha256) {
+			return &ChecksumError{Package: p.String(), Expected: sha256, Actual: actual}
+		}
+	}
+
+	return nil
+}
+
+// openCachedZip opens the cached zip at name if it is valid. If it
+// is corrupt or does not match p.SHA256, it gets removed so that it
+// can be downloaded again.
+func openCachedZip(p *Package, name string) (*ZipReadableCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	if err := verifyZip(p, f, fi.Size(), p.SHA256); err != nil {
+		_ = f.Close()
+		_ = os.Remove(name)
+		return nil, errors.Join(os.ErrNotExist, err)
+	}
+
+	return &ZipReadableCloser{f, fi.Size()}, nil
+}
+
+// GetPackageZip gets the zip of the given package, caching it on disk. Zips are
+// downloaded to a temporary file that is only moved into the cache once it is
+// verified to be a complete zip that matches p.SHA256, if set. Cached zips that
+// fail the same verification are discarded and downloaded again.
 func (c *Client) GetPackageZip(ctx context.Context, p *Package) (*ZipReadableCloser, error) {
 	zipFilePath := filepath.Join(c.dir, fmt.Sprintf("%s.zip", p))
 
-	fi, err := os.Stat(zipFilePath)
+	z, err := openCachedZip(p, zipFilePath)
 	if err == nil {
-		f, err := os.Open(zipFilePath)
-		if err != nil {
-			return nil, err
+		if c.observer != nil {
+			c.observer.CacheHit(p)
 		}
 
-		return &ZipReadableCloser{f, fi.Size()}, nil
+		return z, nil
 	} else if !errors.Is(err, os.ErrNotExist) {
 		return nil, err
+	} else if c.offline {
+		return nil, fmt.Errorf("package %s zip is not cached and the client is offline: %w", p, err)
 	}
 
 	if err = os.MkdirAll(c.dir, 0750); err != nil {
@@ -145,6 +405,7 @@ func (c *Client) GetPackageZip(ctx context.Context, p *Package) (*ZipReadableClo
 			return nil, err
 		}
 		pkg.FullName = pkg.Latest.FullName
+		pkg.SHA256 = p.SHA256
 
 		return c.GetPackageZip(ctx, pkg)
 	}
@@ -160,23 +421,41 @@ func (c *Client) GetPackageZip(ctx context.Context, p *Package) (*ZipReadableClo
 	}
 	defer res.Body.Close()
 
-	f, err := os.Create(zipFilePath)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download package %s zip: %s", p, res.Status)
+	}
+
+	// Download to a temporary file and rename it so that concurrent
+	// readers never see a partially written or unverified one.
+	f, err := os.CreateTemp(c.dir, filepath.Base(zipFilePath)+".*")
 	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(f.Name())
 
-	if _, err := io.Copy(f, res.Body); err != nil {
+	n, err := io.Copy(f, res.Body)
+	if c.observer != nil {
+		c.observer.Downloaded(p, n)
+	}
+	if err != nil {
+		_ = f.Close()
 		return nil, err
 	}
 
-	if res.ContentLength >= 0 {
-		return &ZipReadableCloser{f, res.ContentLength}, nil
+	if res.ContentLength >= 0 && n != res.ContentLength {
+		_ = f.Close()
+		return nil, fmt.Errorf("download package %s zip: got %d of %d bytes", p, n, res.ContentLength)
 	}
 
-	fi, err = f.Stat()
-	if err != nil {
+	if err := verifyZip(p, f, n, p.SHA256); err != nil {
+		_ = f.Close()
 		return nil, err
 	}
 
-	return &ZipReadableCloser{f, fi.Size()}, nil
+	if err := os.Rename(f.Name(), zipFilePath); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &ZipReadableCloser{f, n}, nil
 }
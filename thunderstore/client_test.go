@@ -0,0 +1,92 @@
+package thunderstore_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+func TestGetPackageZip(t *testing.T) {
+	var (
+		pkgZip    = newZip(t, map[string]string{"plugins/Mod.dll": "dll"})
+		slipZip   = newZip(t, map[string]string{"../../escape.dll": "dll"})
+		sum       = sha256.Sum256(pkgZip)
+		checksum  = hex.EncodeToString(sum[:])
+		downloads = &atomic.Int64{}
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/package/download/"), "/") {
+		case "a/Mod/1.0.0":
+			downloads.Add(1)
+			_, _ = w.Write(pkgZip)
+		case "a/Slip/1.0.0":
+			_, _ = w.Write(slipZip)
+		default:
+			http.Error(w, "<html>Internal Server Error</html>", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse fake Thunderstore URL: %v", err)
+	}
+
+	var (
+		ctx    = context.Background()
+		dir    = t.TempDir()
+		client = thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(dir))
+	)
+
+	if _, err := client.GetPackageZip(ctx, &thunderstore.Package{Namespace: "a", Name: "Broken", VersionNumber: "1.0.0"}); err == nil {
+		t.Fatal("expected error downloading package with unsuccessful response")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "a-Broken-1.0.0.zip")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected unsuccessful response not to be cached, got %v", err)
+	}
+
+	checksumErr := &thunderstore.ChecksumError{}
+	if _, err := client.GetPackageZip(ctx, &thunderstore.Package{Namespace: "a", Name: "Mod", VersionNumber: "1.0.0", SHA256: strings.Repeat("0", 64)}); !errors.As(err, &checksumErr) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+
+	pkg := &thunderstore.Package{Namespace: "a", Name: "Mod", VersionNumber: "1.0.0", SHA256: checksum}
+
+	z, err := client.GetPackageZip(ctx, pkg)
+	if err != nil {
+		t.Fatalf("failed to get package zip: %v", err)
+	}
+	_ = z.Close()
+
+	// A corrupted cached zip gets downloaded again.
+	if err := os.WriteFile(filepath.Join(dir, "a-Mod-1.0.0.zip"), []byte("corrupt"), 0644); err != nil {
+		t.Fatalf("failed to corrupt cached zip: %v", err)
+	}
+
+	z, err = client.GetPackageZip(ctx, pkg)
+	if err != nil {
+		t.Fatalf("failed to get package zip: %v", err)
+	}
+	_ = z.Close()
+
+	if n := downloads.Load(); n != 3 {
+		t.Fatalf("expected 3 downloads, got %d", n)
+	}
+
+	if _, err := thunderstore.Open(ctx, &thunderstore.Package{Namespace: "a", Name: "Slip", VersionNumber: "1.0.0"}, &thunderstore.OpenOpts{Client: client}); err == nil {
+		t.Fatal("expected error opening package zip with unsafe paths")
+	}
+}
@@ -0,0 +1,80 @@
+package thunderstore
+
+import (
+	"fmt"
+	"slices"
+)
+
+// BepInExPacks are the packages that install BepInEx for each
+// Thunderstore community, keyed by the community's identifier.
+// Mods for a community generally depend on its BepInEx pack.
+var BepInExPacks = map[string]string{
+	"valheim":              "denikson-BepInExPack_Valheim",
+	"riskofrain2":          "bbepis-BepInExPack",
+	"lethal-company":       "BepInEx-BepInExPack",
+	"content-warning":      "BepInEx-BepInExPack",
+	"repo":                 "BepInEx-BepInExPack",
+	"dyson-sphere-program": "xiaoye97-BepInEx",
+}
+
+// WithCommunity makes the Client only consider packages'
+// listings in the community with the given identifier, e.g.
+// "valheim", and use its BepInEx pack.
+func WithCommunity(community string) ClientOpt {
+	return func(c *Client) {
+		c.community = community
+	}
+}
+
+// WithBepInExPack overrides the BepInEx pack of
+// the Client's community, e.g. "denikson-BepInExPack_Valheim".
+func WithBepInExPack(fullname string) ClientOpt {
+	return func(c *Client) {
+		c.bepInExPack = fullname
+	}
+}
+
+// Community returns the identifier of the Client's community,
+// or an empty string if it is not for a specific one.
+func (c *Client) Community() string {
+	return c.community
+}
+
+// BepInExPack returns the versionless package that installs BepInEx
+// for the Client's community. It errors if the Client does not know
+// of one, in which case one can be set via WithBepInExPack.
+func (c *Client) BepInExPack() (*Package, error) {
+	fullname := c.bepInExPack
+	if fullname == "" {
+		var ok bool
+		if fullname, ok = BepInExPacks[c.community]; !ok {
+			return nil, fmt.Errorf("no known BepInEx pack for community %q", c.community)
+		}
+	}
+
+	pkg, err := ParsePackageFullname(fullname)
+	if err != nil {
+		return nil, fmt.Errorf("parse BepInEx pack: %w", err)
+	}
+
+	return &Package{Namespace: pkg.Namespace, Name: pkg.Name}, nil
+}
+
+// IsBepInExPack reports whether p is the BepInEx pack of the Client's community.
+func (c *Client) IsBepInExPack(p *Package) bool {
+	bepInExPack, err := c.BepInExPack()
+
+	return err == nil && bepInExPack.Namespace == p.Namespace && bepInExPack.Name == p.Name
+}
+
+// filterCommunityListings removes p's listings in communities other than
+// the Client's. Listings that do not say which community they are in are kept.
+func (c *Client) filterCommunityListings(p *Package) {
+	if c.community == "" {
+		return
+	}
+
+	p.CommunityListings = slices.DeleteFunc(p.CommunityListings, func(communityListing CommunityListing) bool {
+		return communityListing.Community != "" && communityListing.Community != c.community
+	})
+}
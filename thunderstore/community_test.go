@@ -0,0 +1,61 @@
+package thunderstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+func TestCommunity(t *testing.T) {
+	u, _ := fakeThunderstore(t, map[string][]thunderstore.Package{
+		"BepInEx/BepInExPack": {
+			{
+				Namespace:     "BepInEx",
+				Name:          "BepInExPack",
+				VersionNumber: "5.4.2100",
+				CommunityListings: []thunderstore.CommunityListing{
+					{Community: "lethal-company", Categories: []string{"BepInEx"}},
+					{Community: "content-warning", Categories: []string{"Libraries"}},
+				},
+			},
+		},
+	})
+
+	client := thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(t.TempDir()), thunderstore.WithCommunity("lethal-company"))
+
+	if client.Community() != "lethal-company" {
+		t.Fatalf("expected community lethal-company, got %s", client.Community())
+	}
+
+	bepInExPack, err := client.BepInExPack()
+	if err != nil || bepInExPack.Versionless() != "BepInEx-BepInExPack" {
+		t.Fatalf("expected BepInEx-BepInExPack, got %+v, %v", bepInExPack, err)
+	}
+
+	pkg, err := client.GetPackage(context.Background(), bepInExPack)
+	if err != nil {
+		t.Fatalf("failed to get package: %v", err)
+	}
+
+	if !client.IsBepInExPack(pkg) {
+		t.Fatalf("expected %s to be the BepInEx pack", pkg.String())
+	}
+
+	// Only the listing in the client's community is considered.
+	if len(pkg.CommunityListings) != 1 || pkg.CommunityListings[0].Categories[0] != "BepInEx" {
+		t.Fatalf("expected only the lethal-company listing, got %+v", pkg.CommunityListings)
+	}
+
+	if _, err := thunderstore.NewClient().BepInExPack(); err == nil {
+		t.Fatal("expected error getting BepInEx pack without a community")
+	}
+
+	if _, err := thunderstore.NewClient(thunderstore.WithCommunity("unknown")).BepInExPack(); err == nil {
+		t.Fatal("expected error getting BepInEx pack of unknown community")
+	}
+
+	if p, err := thunderstore.NewClient(thunderstore.WithCommunity("unknown"), thunderstore.WithBepInExPack("someone-BepInExPack_Fork")).BepInExPack(); err != nil || p.Versionless() != "someone-BepInExPack_Fork" {
+		t.Fatalf("expected overridden BepInEx pack, got %+v, %v", p, err)
+	}
+}
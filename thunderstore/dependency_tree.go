@@ -2,98 +2,566 @@ package thunderstore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
 )
 
-func DependencyTree(ctx context.Context, pkgNames ...string) ([]Package, error) {
-	b := new(depTreeBldr)
+// Constraint is a requirement on the version of a package.
+type Constraint struct {
+	// Version is the version that is required.
+	// If empty, any version satisfies the Constraint.
+	Version string
+	// Exact is true if exactly Version is required, as
+	// opposed to Version or a later one with the same
+	// major version, as is the case for dependencies.
+	Exact bool
+	// Path is the chain of packages that depended on the
+	// package, starting from the one that was requested.
+	// It is empty if the package itself was requested.
+	Path []string
+}
 
-	if err := b.buildDependencyTree(ctx, nil, pkgNames...); err != nil {
-		return nil, err
+func (c *Constraint) String() string {
+	switch {
+	case c.Version == "":
+		return "any version"
+	case c.Exact:
+		return "=" + c.Version
 	}
 
-	var (
-		pkgs = make([]Package, len(b.seenPkgs))
-		i    int
-	)
-	for _, seenPkg := range b.seenPkgs {
-		pkgs[i] = seenPkg
-		i++
+	return "^" + c.Version
+}
+
+func (c *Constraint) allows(v version) bool {
+	if c.Version == "" {
+		return true
+	}
+
+	w, err := parseVersion(c.Version)
+	if err != nil {
+		return false
+	}
+
+	if c.Exact {
+		return v.compare(w) == 0
+	}
+
+	return v[0] == w[0] && v.compare(w) >= 0
+}
+
+// ConflictError is returned by DependencyTree when no version
+// of a package satisfies every Constraint on it.
+type ConflictError struct {
+	Package     string
+	Constraints []Constraint
+}
+
+func (e *ConflictError) Error() string {
+	constraints := make([]string, len(e.Constraints))
+
+	for i, constraint := range e.Constraints {
+		via := "requested"
+		if len(constraint.Path) > 0 {
+			via = strings.Join(constraint.Path, " -> ")
+		}
+
+		constraints[i] = fmt.Sprintf("%s (%s)", constraint.String(), via)
 	}
 
-	return pkgs, nil
+	return fmt.Sprintf("no version of %s satisfies all of: %s", e.Package, strings.Join(constraints, ", "))
+}
+
+const (
+	// maxResolutions bounds how many times the dependency tree is walked
+	// while the selected versions are still changing, in case they never settle.
+	maxResolutions = 100
+	// DependencyTreeConcurrency is how many packages'
+	// metadata DependencyTree gets at once.
+	DependencyTreeConcurrency = 8
+)
+
+// DependencyTree resolves the given packages and all of their dependencies,
+// selecting the highest version of each package that satisfies every Constraint
+// on it. If DefaultClient is for a community, every version of each package that
+// is listed in it is considered, so a dependency can resolve to a version that
+// nothing mentions, e.g. a newer patch than any dependent requires. Packages
+// are returned in topological order, dependencies first.
+func DependencyTree(ctx context.Context, pkgNames ...string) ([]Package, error) {
+	b := &depTreeBldr{client: DefaultClient}
+
+	return b.buildDependencyTree(ctx, pkgNames...)
 }
 
 type depTreeBldr struct {
-	client   *Client
-	seenPkgs map[string]Package
+	client *Client
+	mu     sync.Mutex
+	// pkgs caches packages by their String(), where
+	// a package without a version is the latest one.
+	pkgs map[string]*Package
+
+	versionsOnce sync.Once
+	// versions holds the versions of each package
+	// listed in the client's community, if any.
+	versions    map[string][]string
+	versionsErr error
+}
+
+// depTreeRoot is a package that was requested.
+type depTreeRoot struct {
+	pkg        *Package
+	categories []string
+}
+
+// depTreeWalk is what walking the dependency tree
+// with a given selection of versions found.
+type depTreeWalk struct {
+	constraints map[string][]Constraint
+	deps        map[string][]string
+	// pkgs holds the namespace and name of each package.
+	pkgs map[string]*Package
+	// resolved holds each package whose version was selected.
+	resolved map[string]*Package
 }
 
-func (b *depTreeBldr) buildDependencyTree(ctx context.Context, communityListings []CommunityListing, pkgNames ...string) error {
+func (b *depTreeBldr) buildDependencyTree(ctx context.Context, pkgNames ...string) ([]Package, error) {
+	roots := []depTreeRoot{}
+
 	for _, pkgName := range pkgNames {
 		u, err := url.Parse(pkgName)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if u.Scheme != "" && u.Scheme != Scheme {
-			return fmt.Errorf("unsupported scheme %s", u.Scheme)
+			return nil, fmt.Errorf("unsupported scheme %s", u.Scheme)
 		}
 
 		pkg, err := ParsePackage(fmt.Sprintf("%s%s", u.Host, u.Path))
 		if err != nil {
+			return nil, err
+		}
+
+		roots = append(roots, depTreeRoot{pkg: pkg, categories: u.Query()["category"]})
+	}
+
+	// Walk the tree with the current selection of versions to find
+	// the constraints on each package, select the versions that satisfy
+	// them and repeat until the selection stops changing, since selecting
+	// a different version of a package changes the constraints on its dependencies.
+	selected := map[string]string{}
+
+	for range maxResolutions {
+		walk, err := b.walk(ctx, roots, selected)
+		if err != nil {
+			return nil, err
+		}
+
+		// Get the latest version of each package that any version
+		// is acceptable for all at once before selecting versions.
+		latest := []*Package{}
+		for key, constraints := range walk.constraints {
+			if slices.ContainsFunc(constraints, func(constraint Constraint) bool {
+				return constraint.Version == ""
+			}) {
+				latest = append(latest, &Package{Namespace: walk.pkgs[key].Namespace, Name: walk.pkgs[key].Name})
+			}
+		}
+
+		if _, err := b.getPackages(ctx, latest); err != nil {
+			return nil, err
+		}
+
+		next := map[string]string{}
+		for key, constraints := range walk.constraints {
+			if next[key], err = b.selectVersion(ctx, walk.pkgs[key], constraints); err != nil {
+				return nil, err
+			}
+		}
+
+		if maps.Equal(selected, next) {
+			if err := b.getCommunityListings(ctx, roots, walk); err != nil {
+				return nil, err
+			}
+
+			return b.sort(roots, walk), nil
+		}
+
+		selected = next
+	}
+
+	return nil, fmt.Errorf("dependency tree did not settle after %d resolutions", maxResolutions)
+}
+
+func (b *depTreeBldr) cachedPackage(pkg *Package) (*Package, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if p, ok := b.pkgs[pkg.String()]; ok {
+		return p, true
+	}
+
+	// Use the latest version of the package if it is
+	// the requested one rather than getting it again.
+	if latest, ok := b.pkgs[pkg.Versionless()]; ok && latest.Latest != nil && latest.Latest.VersionNumber == pkg.VersionNumber {
+		return latest, true
+	}
+
+	return nil, false
+}
+
+func (b *depTreeBldr) getPackage(ctx context.Context, pkg *Package) (*Package, error) {
+	if p, ok := b.cachedPackage(pkg); ok {
+		return p, nil
+	}
+
+	p, err := b.client.GetPackage(ctx, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pkgs == nil {
+		b.pkgs = map[string]*Package{}
+	}
+
+	b.pkgs[pkg.String()] = p
+
+	return p, nil
+}
+
+// getPackages gets the given packages concurrently.
+func (b *depTreeBldr) getPackages(ctx context.Context, pkgs []*Package) ([]*Package, error) {
+	var (
+		eg, egctx = errgroup.WithContext(ctx)
+		got       = make([]*Package, len(pkgs))
+	)
+	eg.SetLimit(DependencyTreeConcurrency)
+
+	for i, pkg := range pkgs {
+		eg.Go(func() error {
+			var err error
+			got[i], err = b.getPackage(egctx, pkg)
 			return err
+		})
+	}
+
+	return got, eg.Wait()
+}
+
+func (b *depTreeBldr) walk(ctx context.Context, roots []depTreeRoot, selected map[string]string) (*depTreeWalk, error) {
+	var (
+		walk = &depTreeWalk{
+			constraints: map[string][]Constraint{},
+			deps:        map[string][]string{},
+			pkgs:        map[string]*Package{},
+			resolved:    map[string]*Package{},
 		}
+		paths    = map[string][]string{}
+		frontier = []string{}
+		visited  = map[string]bool{}
+	)
+
+	for _, root := range roots {
+		key := root.pkg.Versionless()
 
-		if b == nil {
-			b = new(depTreeBldr)
+		walk.constraints[key] = append(walk.constraints[key], Constraint{
+			Version: root.pkg.VersionNumber,
+			Exact:   root.pkg.VersionNumber != "",
+		})
+		walk.pkgs[key] = &Package{Namespace: root.pkg.Namespace, Name: root.pkg.Name}
+		paths[key] = []string{}
+		frontier = append(frontier, key)
+	}
+
+	// Walk the tree breadth-first, getting each
+	// level of it concurrently.
+	for len(frontier) > 0 {
+		var (
+			keys = []string{}
+			pkgs = []*Package{}
+		)
+
+		for _, key := range frontier {
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			v, ok := selected[key]
+			if !ok {
+				// The package was just found, so its
+				// version gets selected on the next walk.
+				continue
+			}
+
+			keys = append(keys, key)
+			pkgs = append(pkgs, &Package{Namespace: walk.pkgs[key].Namespace, Name: walk.pkgs[key].Name, VersionNumber: v})
 		}
 
-		if b.seenPkgs == nil {
-			b.seenPkgs = map[string]Package{}
+		pkgs, err := b.getPackages(ctx, pkgs)
+		if err != nil {
+			return nil, err
 		}
 
-		if _, found := b.seenPkgs[pkg.Versionless()]; found && pkg.VersionNumber == "" {
-			continue
+		frontier = []string{}
+
+		for i, key := range keys {
+			var (
+				pkg = pkgs[i]
+				v   = selected[key]
+			)
+			walk.resolved[key] = pkg
+
+			deps := pkg.Dependencies
+			if pkg.Latest != nil {
+				deps = pkg.Latest.Dependencies
+			}
+
+			for _, dep := range deps {
+				d, err := ParsePackage(dep)
+				if err != nil {
+					return nil, err
+				}
+
+				depKey := d.Versionless()
+
+				walk.constraints[depKey] = append(walk.constraints[depKey], Constraint{
+					Version: d.VersionNumber,
+					Path:    append(slices.Clone(paths[key]), fmt.Sprintf("%s-%s", key, v)),
+				})
+				walk.deps[key] = append(walk.deps[key], depKey)
+
+				if _, ok := walk.pkgs[depKey]; !ok {
+					walk.pkgs[depKey] = &Package{Namespace: d.Namespace, Name: d.Name}
+					paths[depKey] = append(slices.Clone(paths[key]), fmt.Sprintf("%s-%s", key, v))
+				}
+
+				frontier = append(frontier, depKey)
+			}
+		}
+	}
+
+	return walk, nil
+}
+
+// listedVersions gets the versions of every package in the client's community
+// the first time that it is called. Without a community or, when offline, a cached
+// listing of it, only the versions that are constrained to can be considered.
+func (b *depTreeBldr) listedVersions(ctx context.Context) (map[string][]string, error) {
+	b.versionsOnce.Do(func() {
+		if b.client.community == "" {
+			return
+		}
+
+		b.versions, b.versionsErr = b.client.listedVersions(ctx)
+		if errors.Is(b.versionsErr, errNotCached) {
+			b.versionsErr = nil
+		}
+	})
+
+	return b.versions, b.versionsErr
+}
+
+// selectVersion returns the highest version of pkg that satisfies every
+// constraint, considering each version of it that is listed in the client's
+// community, each version that is constrained to and the latest version.
+func (b *depTreeBldr) selectVersion(ctx context.Context, pkg *Package, constraints []Constraint) (string, error) {
+	candidates := []version{}
+
+	versions, err := b.listedVersions(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, listed := range versions[pkg.Versionless()] {
+		// Versions that do not parse cannot satisfy a constraint anyways.
+		if v, err := parseVersion(listed); err == nil {
+			candidates = append(candidates, v)
+		}
+	}
+
+	for _, constraint := range constraints {
+		if constraint.Version == "" {
+			latest, err := b.getPackage(ctx, &Package{Namespace: pkg.Namespace, Name: pkg.Name})
+			if err != nil {
+				return "", err
+			}
+
+			if latest.Latest == nil {
+				return "", fmt.Errorf("package %s has no latest version", pkg.Versionless())
+			}
+
+			constraint = Constraint{Version: latest.Latest.VersionNumber}
+		}
+
+		v, err := parseVersion(constraint.Version)
+		if err != nil {
+			return "", fmt.Errorf("package %s: %w", pkg.Versionless(), err)
+		}
+
+		candidates = append(candidates, v)
+	}
+
+	slices.SortFunc(candidates, func(a, b version) int {
+		return b.compare(a)
+	})
+
+	for _, candidate := range candidates {
+		if !slices.ContainsFunc(constraints, func(constraint Constraint) bool {
+			return !constraint.allows(candidate)
+		}) {
+			return candidate.String(), nil
 		}
+	}
+
+	return "", &ConflictError{Package: pkg.Versionless(), Constraints: constraints}
+}
+
+// getCommunityListings gets the latest version of each requested package and of each package
+// that a modpack lists, since only the latest version of a package comes with its community
+// listings and those packages do not inherit any, e.g. to tell if they are server-side.
+func (b *depTreeBldr) getCommunityListings(ctx context.Context, roots []depTreeRoot, walk *depTreeWalk) error {
+	var (
+		keys    = []string{}
+		visited = map[string]bool{}
+	)
 
-		if b.client == nil {
-			b.client = DefaultClient
+	for _, root := range roots {
+		keys = append(keys, root.pkg.Versionless())
+	}
+
+	for len(keys) > 0 {
+		pkgs := []*Package{}
+		for _, key := range keys {
+			pkgs = append(pkgs, &Package{Namespace: walk.pkgs[key].Namespace, Name: walk.pkgs[key].Name})
 		}
 
-		p, err := b.client.GetPackage(ctx, pkg)
+		latest, err := b.getPackages(ctx, pkgs)
 		if err != nil {
 			return err
 		}
 
-		if p.CommunityListings == nil {
-			p.CommunityListings = []CommunityListing{}
+		next := []string{}
+		for i, key := range keys {
+			visited[key] = true
+
+			if latest[i].IsModpack() {
+				for _, dep := range walk.deps[key] {
+					if !visited[dep] {
+						next = append(next, dep)
+					}
+				}
+			}
 		}
 
-		if communityListings != nil {
-			p.CommunityListings = append(p.CommunityListings, communityListings...)
+		keys = next
+	}
+
+	return nil
+}
+
+// sort returns the packages found by walk in topological order, dependencies
+// first, with each package's community listings including those of the packages
+// that depend on it so that, e.g., dependencies of server-side mods are treated
+// as server-side, too. Modpacks do not pass their community listings on, since
+// the mods that they list are as good as requested themselves.
+func (b *depTreeBldr) sort(roots []depTreeRoot, walk *depTreeWalk) []Package {
+	var (
+		order   = []string{}
+		visited = map[string]bool{}
+		visit   func(string)
+	)
+
+	visit = func(key string) {
+		if visited[key] {
+			return
 		}
+		visited[key] = true
+
+		deps := slices.Clone(walk.deps[key])
+		slices.Sort(deps)
 
-		q := u.Query()
+		for _, dep := range deps {
+			visit(dep)
+		}
+
+		order = append(order, key)
+	}
 
-		if categories, ok := q["category"]; ok {
-			p.CommunityListings = append(p.CommunityListings, CommunityListing{
-				Categories: categories,
+	for _, root := range roots {
+		visit(root.pkg.Versionless())
+	}
+
+	var (
+		pkgs  = make([]Package, len(order))
+		index = make(map[string]int, len(order))
+	)
+
+	for i, key := range order {
+		pkgs[i] = *walk.resolved[key]
+		pkgs[i].Namespace = walk.pkgs[key].Namespace
+		pkgs[i].Name = walk.pkgs[key].Name
+		index[key] = i
+
+		communityListings := pkgs[i].CommunityListings
+		// Only the latest version of a package comes with its community
+		// listings, so use them for whichever version was selected.
+		if latest, ok := b.pkgs[key]; ok && len(communityListings) == 0 {
+			communityListings = latest.CommunityListings
+		}
+
+		pkgs[i].CommunityListings = appendCommunityListings(nil, communityListings...)
+	}
+
+	for _, root := range roots {
+		if len(root.categories) > 0 {
+			i := index[root.pkg.Versionless()]
+			pkgs[i].CommunityListings = appendCommunityListings(pkgs[i].CommunityListings, CommunityListing{
+				Categories: root.categories,
 			})
 		}
+	}
 
-		b.seenPkgs[p.Versionless()] = *p
+	// Each package comes after everything that it depends on, so going
+	// backwards visits every dependent of a package before the package.
+	for i := len(order) - 1; i >= 0; i-- {
+		if pkgs[i].IsModpack() {
+			continue
+		}
 
-		deps := p.Dependencies
-		if p.Latest != nil {
-			deps = p.Latest.Dependencies
+		for _, dep := range walk.deps[order[i]] {
+			j := index[dep]
+			pkgs[j].CommunityListings = appendCommunityListings(pkgs[j].CommunityListings, pkgs[i].CommunityListings...)
 		}
+	}
 
-		if err = b.buildDependencyTree(ctx, p.CommunityListings, deps...); err != nil {
-			return err
+	return pkgs
+}
+
+func appendCommunityListings(communityListings []CommunityListing, toAppend ...CommunityListing) []CommunityListing {
+	if communityListings == nil {
+		communityListings = []CommunityListing{}
+	}
+
+	for _, communityListing := range toAppend {
+		if !slices.ContainsFunc(communityListings, func(c CommunityListing) bool {
+			return c.Community == communityListing.Community &&
+				c.HasNsfwContent == communityListing.HasNsfwContent &&
+				c.ReviewStatus == communityListing.ReviewStatus &&
+				slices.Equal(c.Categories, communityListing.Categories)
+		}) {
+			communityListings = append(communityListings, communityListing)
 		}
 	}
 
-	return nil
+	return communityListings
 }
@@ -0,0 +1,279 @@
+package thunderstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+// fakeThunderstore serves the experimental package API and the valheim
+// community's listing for the given packages, keyed by "namespace/name", where
+// the last version is the latest. It counts the requests that it responds to
+// with a body.
+func fakeThunderstore(t *testing.T, pkgs map[string][]thunderstore.Package) (*url.URL, *atomic.Int64) {
+	requests := &atomic.Int64{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/c/valheim/api/v1/package/" {
+			requests.Add(1)
+
+			listing := []map[string]any{}
+			for _, versions := range pkgs {
+				listedVersions := []map[string]any{}
+				for i := len(versions) - 1; i >= 0; i-- {
+					listedVersions = append(listedVersions, map[string]any{
+						"name":           versions[i].Name,
+						"full_name":      versions[i].String(),
+						"version_number": versions[i].VersionNumber,
+						"is_active":      true,
+					})
+				}
+
+				listing = append(listing, map[string]any{
+					"name":      versions[0].Name,
+					"full_name": versions[0].Versionless(),
+					"owner":     versions[0].Namespace,
+					"versions":  listedVersions,
+				})
+			}
+
+			_ = json.NewEncoder(w).Encode(listing)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/experimental/package/"), "/"), "/")
+
+		versions, ok := pkgs[strings.Join(parts[:2], "/")]
+		if !ok {
+			_ = json.NewEncoder(w).Encode(&thunderstore.Package{Detail: "Not found."})
+			return
+		}
+
+		requests.Add(1)
+
+		if len(parts) == 2 {
+			latest := versions[len(versions)-1]
+
+			etag := `"` + latest.VersionNumber + `"`
+			if r.Header.Get("If-None-Match") == etag {
+				requests.Add(-1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.Header().Set("ETag", etag)
+			_ = json.NewEncoder(w).Encode(&thunderstore.Package{
+				Namespace: latest.Namespace,
+				Name:      latest.Name,
+				Latest: &thunderstore.Latest{
+					Namespace:     latest.Namespace,
+					Name:          latest.Name,
+					VersionNumber: latest.VersionNumber,
+					Dependencies:  latest.Dependencies,
+				},
+				CommunityListings: latest.CommunityListings,
+			})
+			return
+		}
+
+		for _, version := range versions {
+			if version.VersionNumber == parts[2] {
+				version.CommunityListings = nil
+				_ = json.NewEncoder(w).Encode(&version)
+				return
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(&thunderstore.Package{Detail: "Not found."})
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse fake Thunderstore URL: %v", err)
+	}
+
+	return u, requests
+}
+
+func TestDependencyTree(t *testing.T) {
+	defaultClient := thunderstore.DefaultClient
+	t.Cleanup(func() {
+		thunderstore.DefaultClient = defaultClient
+	})
+
+	var (
+		dir  = t.TempDir()
+		u, _ = fakeThunderstore(t, map[string][]thunderstore.Package{
+			"denikson/BepInExPack_Valheim": {
+				{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2100"},
+				{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2200"},
+				{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2202"},
+			},
+			"ValheimModding/Jotunn": {
+				{Namespace: "ValheimModding", Name: "Jotunn", VersionNumber: "2.20.0", Dependencies: []string{"denikson-BepInExPack_Valheim-5.4.2100"}},
+			},
+			"RandyKnapp/EquipmentAndQuickSlots": {
+				{
+					Namespace:         "RandyKnapp",
+					Name:              "EquipmentAndQuickSlots",
+					VersionNumber:     "2.1.11",
+					Dependencies:      []string{"ValheimModding-Jotunn-2.20.0", "denikson-BepInExPack_Valheim-5.4.2200"},
+					CommunityListings: []thunderstore.CommunityListing{{Categories: []string{"Server-side"}}},
+				},
+			},
+		})
+	)
+
+	thunderstore.DefaultClient = thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(dir))
+
+	for range 3 {
+		pkgs, err := thunderstore.DependencyTree(context.Background(), "RandyKnapp/EquipmentAndQuickSlots")
+		if err != nil {
+			t.Fatalf("failed to resolve dependency tree: %v", err)
+		}
+
+		names := make([]string, len(pkgs))
+		for i, pkg := range pkgs {
+			names[i] = pkg.String()
+
+			if len(pkg.CommunityListings) == 0 || pkg.CommunityListings[0].Categories[0] != "Server-side" {
+				t.Fatalf("expected %s to inherit Server-side category, got %+v", pkg.String(), pkg.CommunityListings)
+			}
+		}
+
+		// The highest version of BepInEx that any dependent requires,
+		// dependencies before dependents and otherwise sorted by name.
+		expected := "denikson-BepInExPack_Valheim-5.4.2200,ValheimModding-Jotunn-2.20.0,RandyKnapp-EquipmentAndQuickSlots-2.1.11"
+		if actual := strings.Join(names, ","); actual != expected {
+			t.Fatalf("expected %s, got %s", expected, actual)
+		}
+	}
+
+	pkgs, err := thunderstore.DependencyTree(context.Background(), "RandyKnapp/EquipmentAndQuickSlots", "denikson/BepInExPack_Valheim")
+	if err != nil {
+		t.Fatalf("failed to resolve dependency tree: %v", err)
+	}
+
+	if pkgs[0].String() != "denikson-BepInExPack_Valheim-5.4.2202" {
+		t.Fatalf("expected latest BepInEx to be compatible, got %s", pkgs[0].String())
+	}
+
+	_, err = thunderstore.DependencyTree(context.Background(), "RandyKnapp/EquipmentAndQuickSlots", "denikson/BepInExPack_Valheim/5.4.2100")
+	conflictErr := &thunderstore.ConflictError{}
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+
+	if conflictErr.Package != "denikson-BepInExPack_Valheim" || len(conflictErr.Constraints) != 2 {
+		t.Fatalf("expected 2 conflicting constraints on BepInEx, got %+v", conflictErr)
+	}
+
+	if msg := conflictErr.Error(); !strings.Contains(msg, "=5.4.2100 (requested), ^5.4.2200 (RandyKnapp-EquipmentAndQuickSlots-2.1.11)") {
+		t.Fatalf("expected conflict error to include dependency path, got %s", msg)
+	}
+}
+
+func TestDependencyTreeCache(t *testing.T) {
+	defaultClient := thunderstore.DefaultClient
+	t.Cleanup(func() {
+		thunderstore.DefaultClient = defaultClient
+	})
+
+	var (
+		dir         = t.TempDir()
+		u, requests = fakeThunderstore(t, map[string][]thunderstore.Package{
+			"denikson/BepInExPack_Valheim": {
+				{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2202"},
+			},
+			"ValheimModding/Jotunn": {
+				{Namespace: "ValheimModding", Name: "Jotunn", VersionNumber: "2.20.0", Dependencies: []string{"denikson-BepInExPack_Valheim-5.4.2202"}},
+			},
+		})
+	)
+
+	thunderstore.DefaultClient = thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(dir))
+
+	if _, err := thunderstore.DependencyTree(context.Background(), "ValheimModding/Jotunn"); err != nil {
+		t.Fatalf("failed to resolve dependency tree: %v", err)
+	}
+
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+
+	// Versions are cached and the latest ones get revalidated.
+	if _, err := thunderstore.DependencyTree(context.Background(), "ValheimModding/Jotunn"); err != nil {
+		t.Fatalf("failed to resolve dependency tree: %v", err)
+	}
+
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected no more requests, got %d", n-2)
+	}
+
+	thunderstore.DefaultClient = thunderstore.NewClient(thunderstore.WithURL(&url.URL{Scheme: "http", Host: "offline.invalid"}), thunderstore.WithDir(dir), thunderstore.WithOffline(true))
+
+	pkgs, err := thunderstore.DependencyTree(context.Background(), "ValheimModding/Jotunn")
+	if err != nil {
+		t.Fatalf("failed to resolve dependency tree offline: %v", err)
+	}
+
+	if len(pkgs) != 2 {
+		t.Fatalf("expected 2 packages, got %d", len(pkgs))
+	}
+
+	if _, err := thunderstore.DependencyTree(context.Background(), "RandyKnapp/EquipmentAndQuickSlots"); err == nil {
+		t.Fatal("expected error resolving uncached package offline")
+	}
+}
+
+func TestDependencyTreeUnmentionedVersion(t *testing.T) {
+	defaultClient := thunderstore.DefaultClient
+	t.Cleanup(func() {
+		thunderstore.DefaultClient = defaultClient
+	})
+
+	var (
+		dir  = t.TempDir()
+		u, _ = fakeThunderstore(t, map[string][]thunderstore.Package{
+			"denikson/BepInExPack_Valheim": {
+				{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2100"},
+				{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2200"},
+				{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2202"},
+				{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "6.0.0"},
+			},
+			"ValheimModding/Jotunn": {
+				{Namespace: "ValheimModding", Name: "Jotunn", VersionNumber: "2.20.0", Dependencies: []string{"denikson-BepInExPack_Valheim-5.4.2100"}},
+			},
+			"RandyKnapp/EquipmentAndQuickSlots": {
+				{
+					Namespace:     "RandyKnapp",
+					Name:          "EquipmentAndQuickSlots",
+					VersionNumber: "2.1.11",
+					Dependencies:  []string{"ValheimModding-Jotunn-2.20.0", "denikson-BepInExPack_Valheim-5.4.2200"},
+				},
+			},
+		})
+	)
+
+	thunderstore.DefaultClient = thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(dir), thunderstore.WithCommunity("valheim"))
+
+	pkgs, err := thunderstore.DependencyTree(context.Background(), "RandyKnapp/EquipmentAndQuickSlots")
+	if err != nil {
+		t.Fatalf("failed to resolve dependency tree: %v", err)
+	}
+
+	// No dependent mentions 5.4.2202, but it is the newest version that is
+	// compatible with both of them, whereas 6.0.0 is a different major version.
+	if pkgs[0].String() != "denikson-BepInExPack_Valheim-5.4.2202" {
+		t.Fatalf("expected the newest compatible BepInEx, got %s", pkgs[0].String())
+	}
+}
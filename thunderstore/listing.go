@@ -0,0 +1,258 @@
+package thunderstore
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// SortDownloads, SortRating, SortUpdated and SortName
+	// are the orders that SearchPackages can sort by.
+	SortDownloads = "downloads"
+	SortRating    = "rating"
+	SortUpdated   = "updated"
+	SortName      = "name"
+)
+
+// Sorts are the orders that SearchPackages can sort by.
+var Sorts = []string{SortDownloads, SortRating, SortUpdated, SortName}
+
+// listedPackage is a package in a community's
+// listing from Thunderstore's v1 API.
+type listedPackage struct {
+	Name           string          `json:"name"`
+	FullName       string          `json:"full_name"`
+	Owner          string          `json:"owner"`
+	PackageURL     *URL            `json:"package_url,omitempty"`
+	DateCreated    time.Time       `json:"date_created,omitempty"`
+	DateUpdated    time.Time       `json:"date_updated,omitempty"`
+	RatingScore    int             `json:"rating_score,omitempty"`
+	IsPinned       bool            `json:"is_pinned,omitempty"`
+	IsDeprecated   bool            `json:"is_deprecated,omitempty"`
+	HasNsfwContent bool            `json:"has_nsfw_content,omitempty"`
+	Categories     []string        `json:"categories,omitempty"`
+	Versions       []listedVersion `json:"versions,omitempty"`
+}
+
+type listedVersion struct {
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description,omitempty"`
+	Icon          *URL      `json:"icon,omitempty"`
+	VersionNumber string    `json:"version_number"`
+	Dependencies  []string  `json:"dependencies,omitempty"`
+	DownloadURL   *URL      `json:"download_url,omitempty"`
+	Downloads     int       `json:"downloads,omitempty"`
+	DateCreated   time.Time `json:"date_created,omitempty"`
+	WebsiteURL    *URL      `json:"website_url,omitempty"`
+	IsActive      bool      `json:"is_active,omitempty"`
+}
+
+// toPackage converts the listed package into the shape
+// of the experimental API, which the rest of this package uses.
+func (l *listedPackage) toPackage(community string) Package {
+	pkg := Package{
+		Namespace:    l.Owner,
+		Name:         l.Name,
+		FullName:     l.FullName,
+		Owner:        l.Owner,
+		PackageURL:   l.PackageURL,
+		DateCreated:  l.DateCreated,
+		DateUpdated:  l.DateUpdated,
+		RatingScore:  l.RatingScore,
+		IsPinned:     l.IsPinned,
+		IsDeprecated: l.IsDeprecated,
+		CommunityListings: []CommunityListing{
+			{HasNsfwContent: l.HasNsfwContent, Categories: l.Categories, Community: community},
+		},
+	}
+
+	for _, v := range l.Versions {
+		pkg.TotalDownloads += v.Downloads
+	}
+
+	// Versions are listed newest first.
+	if len(l.Versions) > 0 {
+		latest := l.Versions[0]
+
+		pkg.Description = latest.Description
+		pkg.Icon = latest.Icon
+		pkg.WebsiteURL = latest.WebsiteURL
+		pkg.Latest = &Latest{
+			Namespace:     l.Owner,
+			Name:          l.Name,
+			VersionNumber: latest.VersionNumber,
+			FullName:      latest.FullName,
+			Description:   latest.Description,
+			Icon:          latest.Icon,
+			Dependencies:  latest.Dependencies,
+			DownloadURL:   latest.DownloadURL,
+			Downloads:     latest.Downloads,
+			DateCreated:   latest.DateCreated,
+			WebsiteURL:    latest.WebsiteURL,
+			IsActive:      latest.IsActive,
+		}
+	}
+
+	return pkg
+}
+
+// ListPackages lists every package in the given community, e.g. "valheim",
+// or the Client's if empty, caching the listing on disk and revalidating it
+// like the latest version of a package.
+func (c *Client) ListPackages(ctx context.Context, community string) ([]Package, error) {
+	community = cmp.Or(community, c.community)
+
+	listed, err := c.listPackages(ctx, community)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs := make([]Package, len(listed))
+	for i, l := range listed {
+		pkgs[i] = l.toPackage(community)
+	}
+
+	return pkgs, nil
+}
+
+// listedVersions returns the active version numbers of every package in the
+// Client's community, newest first, keyed by the package's Versionless name.
+func (c *Client) listedVersions(ctx context.Context) (map[string][]string, error) {
+	listed, err := c.listPackages(ctx, c.community)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string][]string, len(listed))
+	for _, l := range listed {
+		key := l.Owner + "-" + l.Name
+
+		for _, v := range l.Versions {
+			if v.IsActive {
+				versions[key] = append(versions[key], v.VersionNumber)
+			}
+		}
+	}
+
+	return versions, nil
+}
+
+func (c *Client) listPackages(ctx context.Context, community string) ([]listedPackage, error) {
+	if community == "" {
+		return nil, fmt.Errorf("no community to list packages of")
+	}
+
+	var (
+		listed   = []listedPackage{}
+		validate = func(b []byte) error {
+			return json.Unmarshal(b, &listed)
+		}
+	)
+
+	b, err := c.getCached(
+		ctx,
+		fmt.Sprintf("%s/", c.thunderstoreURL.JoinPath("/c", community, "/api/v1/package").String()),
+		filepath.Join(c.dir, "listings", community+".json"),
+		false,
+		maxListingSize,
+		validate,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("community %s package listing: %w", community, err)
+	}
+
+	// validate only decodes bodies that did not come from the cache.
+	if len(listed) == 0 {
+		if err := validate(b); err != nil {
+			return nil, err
+		}
+	}
+
+	return listed, nil
+}
+
+// SearchOpts configure SearchPackages.
+type SearchOpts struct {
+	// Query must be in a package's full name or description,
+	// case-insensitively. Empty matches every package.
+	Query string
+	// Categories, e.g. "Server-side", must all be on a package.
+	Categories []string
+	// Sort is one of Sorts. Defaults to SortDownloads.
+	Sort string
+	// Deprecated includes deprecated packages.
+	Deprecated bool
+}
+
+// SearchPackages searches the given community's packages, or the Client's
+// if empty. Pinned packages come first and the rest are ordered by opts.Sort.
+func (c *Client) SearchPackages(ctx context.Context, community string, opts *SearchOpts) ([]Package, error) {
+	o := &SearchOpts{Sort: SortDownloads}
+	if opts != nil {
+		o.Query = opts.Query
+		o.Categories = opts.Categories
+		o.Deprecated = opts.Deprecated
+		o.Sort = cmp.Or(opts.Sort, o.Sort)
+	}
+
+	if !slices.Contains(Sorts, o.Sort) {
+		return nil, fmt.Errorf("invalid sort %s, expected one of %s", o.Sort, strings.Join(Sorts, ", "))
+	}
+
+	pkgs, err := c.ListPackages(ctx, community)
+	if err != nil {
+		return nil, err
+	}
+
+	query := strings.ToLower(o.Query)
+
+	pkgs = slices.DeleteFunc(pkgs, func(pkg Package) bool {
+		if pkg.IsDeprecated && !o.Deprecated {
+			return true
+		}
+
+		if !strings.Contains(strings.ToLower(pkg.FullName), query) && !strings.Contains(strings.ToLower(pkg.Description), query) {
+			return true
+		}
+
+		for _, category := range o.Categories {
+			if !slices.ContainsFunc(pkg.CommunityListings, func(communityListing CommunityListing) bool {
+				return slices.Contains(communityListing.Categories, category)
+			}) {
+				return true
+			}
+		}
+
+		return false
+	})
+
+	slices.SortStableFunc(pkgs, func(a, b Package) int {
+		if a.IsPinned != b.IsPinned {
+			if a.IsPinned {
+				return -1
+			}
+
+			return 1
+		}
+
+		switch o.Sort {
+		case SortRating:
+			return cmp.Compare(b.RatingScore, a.RatingScore)
+		case SortUpdated:
+			return b.DateUpdated.Compare(a.DateUpdated)
+		case SortName:
+			return strings.Compare(strings.ToLower(a.FullName), strings.ToLower(b.FullName))
+		}
+
+		return cmp.Compare(b.TotalDownloads, a.TotalDownloads)
+	})
+
+	return pkgs, nil
+}
@@ -0,0 +1,89 @@
+package thunderstore_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+const listing = `[
+	{"name": "Jotunn", "full_name": "ValheimModding-Jotunn", "owner": "ValheimModding", "rating_score": 300, "categories": ["Libraries", "Server-side", "Client-side"], "versions": [
+		{"name": "Jotunn", "full_name": "ValheimModding-Jotunn-2.20.0", "description": "Jötunn, the Valheim Library.", "version_number": "2.20.0", "downloads": 1000},
+		{"name": "Jotunn", "full_name": "ValheimModding-Jotunn-2.19.0", "description": "Jötunn, the Valheim Library.", "version_number": "2.19.0", "downloads": 5000}
+	]},
+	{"name": "EquipmentAndQuickSlots", "full_name": "RandyKnapp-EquipmentAndQuickSlots", "owner": "RandyKnapp", "rating_score": 500, "categories": ["Server-side", "Client-side"], "versions": [
+		{"name": "EquipmentAndQuickSlots", "full_name": "RandyKnapp-EquipmentAndQuickSlots-2.1.11", "description": "Gives equipment its own slots.", "version_number": "2.1.11", "downloads": 2000}
+	]},
+	{"name": "OldLibrary", "full_name": "someone-OldLibrary", "owner": "someone", "is_deprecated": true, "categories": ["Libraries"], "versions": [
+		{"name": "OldLibrary", "full_name": "someone-OldLibrary-1.0.0", "version_number": "1.0.0", "downloads": 9000}
+	]},
+	{"name": "BepInExPack_Valheim", "full_name": "denikson-BepInExPack_Valheim", "owner": "denikson", "is_pinned": true, "categories": ["Libraries"], "versions": [
+		{"name": "BepInExPack_Valheim", "full_name": "denikson-BepInExPack_Valheim-5.4.2202", "version_number": "5.4.2202", "downloads": 100}
+	]}
+]`
+
+func TestSearchPackages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/c/valheim/api/v1/package/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte(listing))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse fake Thunderstore URL: %v", err)
+	}
+
+	var (
+		ctx    = context.Background()
+		dir    = t.TempDir()
+		client = thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(dir))
+	)
+
+	for _, tc := range []struct {
+		opts     *thunderstore.SearchOpts
+		expected string
+	}{
+		// Pinned packages come first, then the most downloaded across every version.
+		{nil, "denikson-BepInExPack_Valheim,ValheimModding-Jotunn,RandyKnapp-EquipmentAndQuickSlots"},
+		{&thunderstore.SearchOpts{Sort: thunderstore.SortRating, Categories: []string{"Server-side"}}, "RandyKnapp-EquipmentAndQuickSlots,ValheimModding-Jotunn"},
+		{&thunderstore.SearchOpts{Query: "LIBRARY", Deprecated: true}, "someone-OldLibrary,ValheimModding-Jotunn"},
+	} {
+		pkgs, err := client.SearchPackages(ctx, "valheim", tc.opts)
+		if err != nil {
+			t.Fatalf("failed to search packages: %v", err)
+		}
+
+		names := make([]string, len(pkgs))
+		for i, pkg := range pkgs {
+			names[i] = pkg.Versionless()
+		}
+
+		if actual := strings.Join(names, ","); actual != tc.expected {
+			t.Fatalf("expected %s, got %s", tc.expected, actual)
+		}
+	}
+
+	if _, err := client.SearchPackages(ctx, "valheim", &thunderstore.SearchOpts{Sort: "stars"}); err == nil {
+		t.Fatal("expected error searching with invalid sort")
+	}
+
+	// The listing is cached, so it can be searched offline.
+	pkgs, err := thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(dir), thunderstore.WithOffline(true)).SearchPackages(ctx, "valheim", &thunderstore.SearchOpts{Query: "quickslots"})
+	if err != nil {
+		t.Fatalf("failed to search packages offline: %v", err)
+	}
+
+	if len(pkgs) != 1 || pkgs[0].Latest == nil || pkgs[0].Latest.VersionNumber != "2.1.11" {
+		t.Fatalf("expected EquipmentAndQuickSlots 2.1.11, got %+v", pkgs)
+	}
+}
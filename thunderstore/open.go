@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -13,7 +14,6 @@ import (
 	xtar "github.com/frantjc/x/archive/tar"
 	xzip "github.com/frantjc/x/archive/zip"
 	xio "github.com/frantjc/x/io"
-	xslices "github.com/frantjc/x/slices"
 )
 
 type OpenOpts struct {
@@ -54,11 +54,16 @@ func Open(ctx context.Context, pkg *Package, opts ...Opt) (io.ReadCloser, error)
 		return nil, err
 	}
 
-	pkgZipRdr.File = xslices.Map(pkgZipRdr.File, func(f *zip.File, _ int) *zip.File {
+	for _, f := range pkgZipRdr.File {
 		f.Name = strings.ReplaceAll(f.Name, "\\", "/")
-		f.Name = strings.TrimPrefix(f.Name, pkg.Name)
-		return f
-	})
+		// Some packages, e.g. BepInEx, wrap their files in a directory named after themselves.
+		f.Name = strings.TrimPrefix(strings.TrimLeft(f.Name, "/"), pkg.Name+"/")
+
+		// Refuse to extract anything outside of the install directory.
+		if !f.FileInfo().IsDir() && !filepath.IsLocal(filepath.FromSlash(f.Name)) {
+			return nil, fmt.Errorf("package %s zip contains unsafe path %s", pkg, f.Name)
+		}
+	}
 
 	var (
 		baseDir    = filepath.Join(cache.Dir, Scheme, pkg.Namespace)
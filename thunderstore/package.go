@@ -34,6 +34,9 @@ type Package struct {
 	Latest            *Latest            `json:"latest,omitempty"`
 	Detail            string             `json:"detail,omitempty"`
 	CommunityListings []CommunityListing `json:"community_listings,omitempty"`
+	// SHA256 is the expected hex-encoded SHA-256 checksum
+	// of the package's zip, if known, e.g. from a lockfile.
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 type CommunityListing struct {
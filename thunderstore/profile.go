@@ -0,0 +1,383 @@
+package thunderstore
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ProfileExportName is the name of the file in an exported
+	// profile that lists the profile's mods.
+	ProfileExportName = "export.r2x"
+	// ModpackCategory is the category of packages
+	// that only exist to depend on a list of mods.
+	ModpackCategory = "Modpacks"
+)
+
+var (
+	// profileCodePrefix is at the beginning of
+	// a profile that was shared via a profile code.
+	profileCodePrefix = []byte("#r2modman\n")
+	// configDirs are the directories in an exported profile or a
+	// modpack that hold BepInEx config files, in order of precedence.
+	configDirs = []string{"BepInEx/config/", "config/"}
+)
+
+// IsModpack reports whether p is a modpack.
+func (p *Package) IsModpack() bool {
+	for _, communityListing := range p.CommunityListings {
+		for _, category := range communityListing.Categories {
+			if category == ModpackCategory {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Profile is an r2modman or Thunderstore Mod Manager profile
+// as exported to a .r2z file or shared via a profile code.
+type Profile struct {
+	Name string
+	Mods []ProfileMod
+	// Config holds the profile's BepInEx config files,
+	// keyed by their path relative to BepInEx/config.
+	Config map[string][]byte
+}
+
+// ProfileMod is a mod in a Profile.
+type ProfileMod struct {
+	Name    string `yaml:"name"`
+	Version struct {
+		Major int `yaml:"major"`
+		Minor int `yaml:"minor"`
+		Patch int `yaml:"patch"`
+	} `yaml:"version"`
+	Enabled *bool `yaml:"enabled"`
+}
+
+type profileExport struct {
+	ProfileName string       `yaml:"profileName"`
+	Mods        []ProfileMod `yaml:"mods"`
+}
+
+// NewProfile creates a Profile of the given packages and BepInEx config
+// files, keyed by their path relative to BepInEx/config, e.g. to Write.
+func NewProfile(name string, pkgs []Package, config map[string][]byte) (*Profile, error) {
+	p := &Profile{Name: name, Mods: make([]ProfileMod, len(pkgs)), Config: config}
+
+	for i, pkg := range pkgs {
+		versionNumber := pkg.VersionNumber
+		if versionNumber == "" && pkg.Latest != nil {
+			versionNumber = pkg.Latest.VersionNumber
+		}
+
+		v, err := parseVersion(versionNumber)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", pkg.String(), err)
+		}
+
+		enabled := true
+		p.Mods[i] = ProfileMod{Name: pkg.Versionless(), Enabled: &enabled}
+		p.Mods[i].Version.Major, p.Mods[i].Version.Minor, p.Mods[i].Version.Patch = v[0], v[1], v[2]
+	}
+
+	return p, nil
+}
+
+// PackageNames returns the Profile's enabled mods
+// in the form that DependencyTree accepts.
+func (p *Profile) PackageNames() ([]string, error) {
+	pkgNames := []string{}
+
+	for _, mod := range p.Mods {
+		if mod.Enabled != nil && !*mod.Enabled {
+			continue
+		}
+
+		pkg, err := ParsePackageFullname(mod.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		pkgNames = append(pkgNames, fmt.Sprintf("%s/%s/%d.%d.%d", pkg.Namespace, pkg.Name, mod.Version.Major, mod.Version.Minor, mod.Version.Patch))
+	}
+
+	return pkgNames, nil
+}
+
+// WriteConfig writes the Profile's config files to dir,
+// which should be BepInEx's config directory.
+func (p *Profile) WriteConfig(dir string) error {
+	for name, b := range p.Config {
+		if err := writeConfigFile(dir, name, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeConfigFile(dir, name string, b []byte) error {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil
+	}
+
+	dst := filepath.Join(dir, filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, b, 0644)
+}
+
+// readConfig reads the BepInEx config files from
+// an exported profile or modpack package zip.
+func readConfig(zr *zip.Reader) (map[string][]byte, error) {
+	config := map[string][]byte{}
+
+	for _, configDir := range configDirs {
+		for _, f := range zr.File {
+			name := strings.ReplaceAll(f.Name, "\\", "/")
+			if f.FileInfo().IsDir() || !strings.HasPrefix(name, configDir) {
+				continue
+			}
+
+			// Config directories earlier in configDirs take precedence.
+			name = strings.TrimPrefix(name, configDir)
+			if _, ok := config[name]; ok {
+				continue
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+
+			b, err := io.ReadAll(rc)
+			_ = rc.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			config[name] = b
+		}
+	}
+
+	return config, nil
+}
+
+// ReadProfile reads a Profile from an exported .r2z file.
+func ReadProfile(r io.ReaderAt, size int64) (*Profile, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := zr.Open(ProfileExportName)
+	if err != nil {
+		return nil, fmt.Errorf("profile does not contain %s: %w", ProfileExportName, err)
+	}
+	defer f.Close()
+
+	export := &profileExport{}
+	if err := yaml.NewDecoder(f).Decode(export); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", ProfileExportName, err)
+	}
+
+	config, err := readConfig(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Profile{Name: export.ProfileName, Mods: export.Mods, Config: config}, nil
+}
+
+// Write writes the Profile as an .r2z file that r2modman
+// and Thunderstore Mod Manager can import. The same Profile
+// always produces the same bytes.
+func (p *Profile) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	export, err := yaml.Marshal(&profileExport{ProfileName: p.Name, Mods: p.Mods})
+	if err != nil {
+		return err
+	}
+
+	if err := writeZipFile(zw, ProfileExportName, export); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(p.Config))
+	for name := range p.Config {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := writeZipFile(zw, path.Join(configDirs[0], name), p.Config[name]); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, b []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// GetProfile gets the Profile that was shared via the given profile code.
+func (c *Client) GetProfile(ctx context.Context, code string) (*Profile, error) {
+	if c.offline {
+		return nil, fmt.Errorf("cannot get profile %s while the client is offline", code)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet,
+		fmt.Sprintf("%s/", c.thunderstoreURL.JoinPath("/api/experimental/legacyprofile/get", code).String()),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get profile %s: %s", code, res.Status)
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(b, profileCodePrefix) {
+		return nil, fmt.Errorf("profile %s is not an r2modman profile", code)
+	}
+
+	r2z, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(bytes.TrimPrefix(b, profileCodePrefix))))
+	if err != nil {
+		return nil, fmt.Errorf("decoding profile %s: %w", code, err)
+	}
+
+	return ReadProfile(bytes.NewReader(r2z), int64(len(r2z)))
+}
+
+// CreateProfile shares the Profile via Thunderstore,
+// returning the profile code that it can be imported by.
+func (c *Client) CreateProfile(ctx context.Context, p *Profile) (string, error) {
+	if c.offline {
+		return "", fmt.Errorf("cannot create profile %s while the client is offline", p.Name)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := p.Write(buf); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost,
+		fmt.Sprintf("%s/", c.thunderstoreURL.JoinPath("/api/experimental/legacyprofile/create").String()),
+		strings.NewReader(string(profileCodePrefix)+base64.StdEncoding.EncodeToString(buf.Bytes())),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return "", fmt.Errorf("create profile %s: %s", p.Name, res.Status)
+	}
+
+	created := &struct {
+		Key string `json:"key"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(created); err != nil {
+		return "", err
+	}
+
+	if created.Key == "" {
+		return "", fmt.Errorf("create profile %s: no profile code in response", p.Name)
+	}
+
+	return created.Key, nil
+}
+
+// OpenProfile reads the Profile from the .r2z file at the
+// given path or, if there is not one, gets the Profile that
+// was shared via the given profile code.
+func (c *Client) OpenProfile(ctx context.Context, s string) (*Profile, error) {
+	f, err := os.Open(s)
+	if errors.Is(err, os.ErrNotExist) && !strings.HasSuffix(s, ".r2z") {
+		return c.GetProfile(ctx, s)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadProfile(f, fi.Size())
+}
+
+// GetModpackProfile gets the given modpack as a Profile
+// so that its bundled BepInEx config files can be written.
+// Its mods are its dependencies, so they are not included.
+func (c *Client) GetModpackProfile(ctx context.Context, p *Package) (*Profile, error) {
+	pkgZip, err := c.GetPackageZip(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer pkgZip.Close()
+
+	zr, err := zip.NewReader(pkgZip, pkgZip.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := readConfig(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Profile{Name: p.String(), Config: config}, nil
+}
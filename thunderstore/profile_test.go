@@ -0,0 +1,209 @@
+package thunderstore_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frantjc/valheimw/thunderstore"
+)
+
+func newZip(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestProfile(t *testing.T) {
+	r2z := newZip(t, map[string]string{
+		thunderstore.ProfileExportName: `profileName: Friends
+mods:
+  - name: denikson-BepInExPack_Valheim
+    version:
+      major: 5
+      minor: 4
+      patch: 2202
+    enabled: true
+  - name: RandyKnapp-EquipmentAndQuickSlots
+    version:
+      major: 2
+      minor: 1
+      patch: 11
+    enabled: false
+  - name: ValheimModding-Jotunn
+    version:
+      major: 2
+      minor: 20
+      patch: 0
+`,
+		"BepInEx/config/randyknapp.mods.equipmentandquickslots.cfg": "EquipmentSlotsEnabled = true\n",
+		"BepInEx/config/../../escape.cfg":                           "escaped = true\n",
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/experimental/legacyprofile/get/0192a8b7-code/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte("#r2modman\n" + base64.StdEncoding.EncodeToString(r2z)))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse fake Thunderstore URL: %v", err)
+	}
+
+	client := thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(t.TempDir()))
+
+	profile, err := client.OpenProfile(context.Background(), "0192a8b7-code")
+	if err != nil {
+		t.Fatalf("failed to get profile: %v", err)
+	}
+
+	if profile.Name != "Friends" {
+		t.Fatalf("expected profile Friends, got %s", profile.Name)
+	}
+
+	pkgNames, err := profile.PackageNames()
+	if err != nil {
+		t.Fatalf("failed to get package names: %v", err)
+	}
+
+	// Disabled mods are left out.
+	expected := "denikson/BepInExPack_Valheim/5.4.2202,ValheimModding/Jotunn/2.20.0"
+	if actual := strings.Join(pkgNames, ","); actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+
+	dir := t.TempDir()
+	cfgDir := filepath.Join(dir, "BepInEx", "config")
+
+	if err := profile.WriteConfig(cfgDir); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(cfgDir, "randyknapp.mods.equipmentandquickslots.cfg")); err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	} else if string(b) != "EquipmentSlotsEnabled = true\n" {
+		t.Fatalf("unexpected config %q", b)
+	}
+
+	// Config files cannot be written outside of the config directory.
+	if _, err := os.Stat(filepath.Join(dir, "escape.cfg")); err == nil {
+		t.Fatal("expected config file outside of the config directory not to be written")
+	}
+
+	// Exported profiles can be read from disk too.
+	r2zPath := filepath.Join(dir, "friends.r2z")
+	if err := os.WriteFile(r2zPath, r2z, 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+
+	if profile, err = client.OpenProfile(context.Background(), r2zPath); err != nil {
+		t.Fatalf("failed to open profile: %v", err)
+	} else if len(profile.Mods) != 3 {
+		t.Fatalf("expected 3 mods, got %d", len(profile.Mods))
+	}
+
+	if _, err := client.OpenProfile(context.Background(), filepath.Join(dir, "missing.r2z")); err == nil {
+		t.Fatal("expected error opening missing profile")
+	}
+}
+
+func TestCreateProfile(t *testing.T) {
+	profile, err := thunderstore.NewProfile("Friends", []thunderstore.Package{
+		{Namespace: "denikson", Name: "BepInExPack_Valheim", VersionNumber: "5.4.2202"},
+		{Namespace: "ValheimModding", Name: "Jotunn", Latest: &thunderstore.Latest{VersionNumber: "2.20.0"}},
+	}, map[string][]byte{"BepInEx.cfg": []byte("[Logging]\n")})
+	if err != nil {
+		t.Fatalf("failed to create profile: %v", err)
+	}
+
+	var (
+		shared []byte
+		srv    = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodPost && r.URL.Path == "/api/experimental/legacyprofile/create/":
+				shared, _ = io.ReadAll(r.Body)
+				_, _ = w.Write([]byte(`{"key":"0192a8b7-code"}`))
+			case r.Method == http.MethodGet && r.URL.Path == "/api/experimental/legacyprofile/get/0192a8b7-code/":
+				_, _ = w.Write(shared)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse fake Thunderstore URL: %v", err)
+	}
+
+	client := thunderstore.NewClient(thunderstore.WithURL(u), thunderstore.WithDir(t.TempDir()))
+
+	code, err := client.CreateProfile(context.Background(), profile)
+	if err != nil {
+		t.Fatalf("failed to share profile: %v", err)
+	}
+
+	imported, err := client.GetProfile(context.Background(), code)
+	if err != nil {
+		t.Fatalf("failed to get shared profile: %v", err)
+	}
+
+	pkgNames, err := imported.PackageNames()
+	if err != nil {
+		t.Fatalf("failed to get package names: %v", err)
+	}
+
+	expected := "denikson/BepInExPack_Valheim/5.4.2202,ValheimModding/Jotunn/2.20.0"
+	if actual := strings.Join(pkgNames, ","); imported.Name != "Friends" || actual != expected {
+		t.Fatalf("expected Friends with %s, got %s with %s", expected, imported.Name, actual)
+	}
+
+	if cfg := string(imported.Config["BepInEx.cfg"]); cfg != "[Logging]\n" {
+		t.Fatalf("expected shared config, got %q", cfg)
+	}
+
+	// The same profile always produces the same .r2z.
+	a, b := new(bytes.Buffer), new(bytes.Buffer)
+	if err := profile.Write(a); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+
+	if err := profile.Write(b); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Fatal("expected writing the same profile to produce the same bytes")
+	}
+}
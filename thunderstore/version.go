@@ -0,0 +1,40 @@
+package thunderstore
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a Thunderstore package version, which
+// is always of the form Major.Minor.Patch.
+type version [3]int
+
+func parseVersion(s string) (version, error) {
+	v := version{}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != len(v) {
+		return v, fmt.Errorf("invalid version %s", s)
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %s", s)
+		}
+
+		v[i] = n
+	}
+
+	return v, nil
+}
+
+func (v version) compare(w version) int {
+	return cmp.Or(cmp.Compare(v[0], w[0]), cmp.Compare(v[1], w[1]), cmp.Compare(v[2], w[2]))
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
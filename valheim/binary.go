@@ -0,0 +1,167 @@
+package valheim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// binaryReader reads values the way C#'s BinaryReader
+// and Valheim's ZPackage write them: little-endian numbers
+// and strings prefixed with their 7-bit encoded length.
+type binaryReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func newBinaryReader(r io.Reader) *binaryReader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return &binaryReader{r: br}
+	}
+
+	return &binaryReader{r: bufio.NewReader(r)}
+}
+
+func (r *binaryReader) read(v any) {
+	if r.err != nil {
+		return
+	}
+
+	r.err = binary.Read(r.r, binary.LittleEndian, v)
+}
+
+func (r *binaryReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 {
+		r.err = fmt.Errorf("invalid length %d", n)
+		return nil
+	}
+
+	// Lengths come from the file itself, so the buffer only grows as
+	// bytes are actually read instead of trusting n up front. A length
+	// longer than what is left in the file is then an error rather
+	// than an allocation of up to 2GiB.
+	buf := new(bytes.Buffer)
+	if _, err := io.CopyN(buf, r.r, int64(n)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("length %d exceeds remaining data: %w", n, io.ErrUnexpectedEOF)
+		}
+
+		r.err = err
+		return nil
+	}
+
+	return buf.Bytes()
+}
+
+func (r *binaryReader) bool() bool {
+	return r.uint8() != 0
+}
+
+func (r *binaryReader) uint8() uint8 {
+	var v uint8
+	r.read(&v)
+	return v
+}
+
+func (r *binaryReader) uint16() uint16 {
+	var v uint16
+	r.read(&v)
+	return v
+}
+
+func (r *binaryReader) int16() int16 {
+	var v int16
+	r.read(&v)
+	return v
+}
+
+func (r *binaryReader) int32() int32 {
+	var v int32
+	r.read(&v)
+	return v
+}
+
+func (r *binaryReader) uint32() uint32 {
+	var v uint32
+	r.read(&v)
+	return v
+}
+
+func (r *binaryReader) int64() int64 {
+	var v int64
+	r.read(&v)
+	return v
+}
+
+func (r *binaryReader) float32() float32 {
+	var v float32
+	r.read(&v)
+	return v
+}
+
+func (r *binaryReader) float64() float64 {
+	var v float64
+	r.read(&v)
+	return v
+}
+
+func (r *binaryReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		r.err = err
+		return ""
+	} else if n > math.MaxInt32 {
+		r.err = fmt.Errorf("invalid string length %d", n)
+		return ""
+	}
+
+	return string(r.bytes(int(n)))
+}
+
+// binaryWriter is the inverse of binaryReader.
+type binaryWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *binaryWriter) write(v any) {
+	if w.err != nil {
+		return
+	}
+
+	w.err = binary.Write(w.w, binary.LittleEndian, v)
+}
+
+func (w *binaryWriter) bytes(b []byte) {
+	if w.err != nil {
+		return
+	}
+
+	_, w.err = w.w.Write(b)
+}
+
+func (w *binaryWriter) bool(v bool) {
+	if v {
+		w.write(uint8(1))
+		return
+	}
+
+	w.write(uint8(0))
+}
+
+func (w *binaryWriter) string(s string) {
+	w.bytes(binary.AppendUvarint(nil, uint64(len(s))))
+	w.bytes([]byte(s))
+}
@@ -62,6 +62,13 @@ func NewCommand(ctx context.Context, dir string, opts *Opts) (*exec.Cmd, error)
 	)
 
 	cmd.Dir = dir
+	// Interrupt the Valheim server instead of killing it
+	// so that it saves the world before it exits. The BepInEx
+	// start script execs the Valheim server, so this works
+	// for it as well.
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
 	cmd.Env = append(
 		os.Environ(),
 		"SteamappId=892970",
@@ -0,0 +1,394 @@
+package valheim
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// worldVersionZDOFormat is the first world version
+	// whose .db stores ZDOs in the compact, flag-based format.
+	// Older worlds are converted by Valheim when they are loaded.
+	worldVersionZDOFormat = 31
+	// worldVersionNumItems is the first world version
+	// whose .db stores ZDO value counts as variable-length
+	// integers instead of a single byte.
+	worldVersionNumItems = 33
+)
+
+// Vector3 is a Unity Vector3.
+type Vector3 struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+	Z float32 `json:"z"`
+}
+
+// Quaternion is a Unity Quaternion.
+type Quaternion struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+	Z float32 `json:"z"`
+	W float32 `json:"w"`
+}
+
+// Vector2i is a Unity Vector2Int, used by Valheim
+// to identify zones.
+type Vector2i struct {
+	X int32 `json:"x"`
+	Y int32 `json:"y"`
+}
+
+// ZDOID uniquely identifies a ZDO.
+type ZDOID struct {
+	UserID int64  `json:"userID"`
+	ID     uint32 `json:"id"`
+}
+
+func (id ZDOID) String() string {
+	return fmt.Sprintf("%d:%d", id.UserID, id.ID)
+}
+
+// ZDOConnection is a link from one ZDO to another,
+// e.g. between two portals.
+type ZDOConnection struct {
+	Type uint8 `json:"type"`
+	Hash int32 `json:"hash"`
+}
+
+// ZDO is a Zone Data Object, Valheim's representation
+// of every object that exists in the world.
+type ZDO struct {
+	ID         ZDOID                `json:"id"`
+	Sector     [2]int16             `json:"sector"`
+	Position   Vector3              `json:"position"`
+	Rotation   Vector3              `json:"rotation"`
+	Prefab     int32                `json:"prefab"`
+	Persistent bool                 `json:"persistent"`
+	Distant    bool                 `json:"distant"`
+	Type       uint8                `json:"type"`
+	Connection *ZDOConnection       `json:"connection,omitempty"`
+	Floats     map[int32]float32    `json:"floats,omitempty"`
+	Vectors    map[int32]Vector3    `json:"vectors,omitempty"`
+	Quats      map[int32]Quaternion `json:"quats,omitempty"`
+	Ints       map[int32]int32      `json:"ints,omitempty"`
+	Longs      map[int32]int64      `json:"longs,omitempty"`
+	Strings    map[int32]string     `json:"strings,omitempty"`
+	ByteArrays map[int32][]byte     `json:"byteArrays,omitempty"`
+}
+
+var (
+	creatorHash = StableHashCode("creator")
+)
+
+// Creator returns the player ID of the player that built
+// the ZDO, if it was built by a player.
+func (z *ZDO) Creator() (int64, bool) {
+	creator, ok := z.Longs[creatorHash]
+	return creator, ok && creator != 0
+}
+
+// Location is a generated location such as a
+// boss altar, dungeon or trader.
+type Location struct {
+	Name     string  `json:"name"`
+	Position Vector3 `json:"position"`
+	Placed   bool    `json:"placed"`
+}
+
+// RandomEvent is the random event, e.g. a raid,
+// that was active when the world was saved.
+type RandomEvent struct {
+	Timer    float32 `json:"timer"`
+	Name     string  `json:"name,omitempty"`
+	Time     float32 `json:"time"`
+	Position Vector3 `json:"position"`
+}
+
+// WorldDB is the contents of a Valheim world's .db file.
+type WorldDB struct {
+	Version            int32       `json:"version"`
+	NetTime            float64     `json:"netTime"`
+	SessionID          int64       `json:"sessionID"`
+	NextUID            uint32      `json:"nextUID"`
+	ZDOs               []ZDO       `json:"zdos"`
+	GeneratedZones     []Vector2i  `json:"generatedZones"`
+	PGWVersion         int32       `json:"pgwVersion"`
+	LocationVersion    int32       `json:"locationVersion"`
+	GlobalKeys         []string    `json:"globalKeys"`
+	LocationsGenerated bool        `json:"locationsGenerated"`
+	Locations          []Location  `json:"locations"`
+	RandomEvent        RandomEvent `json:"randomEvent"`
+}
+
+// Structures returns the ZDOs that were built by players.
+func (w *WorldDB) Structures() []ZDO {
+	structures := []ZDO{}
+
+	for _, zdo := range w.ZDOs {
+		if _, ok := zdo.Creator(); ok {
+			structures = append(structures, zdo)
+		}
+	}
+
+	return structures
+}
+
+type readDBOpts struct {
+	filterZDO func(*ZDO) bool
+}
+
+type ReadDBOpt func(*readDBOpts)
+
+// WithZDOFilter makes ReadDB only keep the ZDOs for which f returns true.
+// Since worlds can contain millions of ZDOs, this can save a lot of memory.
+func WithZDOFilter(f func(*ZDO) bool) ReadDBOpt {
+	return func(o *readDBOpts) {
+		o.filterZDO = f
+	}
+}
+
+// WithoutZDOs makes ReadDB skip keeping any ZDOs.
+func WithoutZDOs(o *readDBOpts) {
+	o.filterZDO = func(*ZDO) bool {
+		return false
+	}
+}
+
+// ReadWorldDB reads the .db file of the given world in the given savedir.
+func ReadWorldDB(savedir, world string, opts ...ReadDBOpt) (*WorldDB, error) {
+	r, err := OpenDB(savedir, world)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ReadDB(r, opts...)
+}
+
+// ReadDB decodes the contents of a .db file from r.
+func ReadDB(r io.Reader, opts ...ReadDBOpt) (*WorldDB, error) {
+	o := &readDBOpts{}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var (
+		br = newBinaryReader(r)
+		db = &WorldDB{
+			Version: br.int32(),
+			NetTime: br.float64(),
+		}
+	)
+	if br.err != nil {
+		return nil, fmt.Errorf("read .db: %w", br.err)
+	}
+
+	if db.Version < worldVersionZDOFormat {
+		return nil, fmt.Errorf("read .db: unsupported world version %d, load the world in Valheim to upgrade it", db.Version)
+	}
+
+	db.SessionID = br.int64()
+	db.NextUID = br.uint32()
+
+	numZDOs := br.int32()
+	db.ZDOs = make([]ZDO, 0, min(max(numZDOs, 0), 1<<16))
+
+	for range numZDOs {
+		if br.err != nil {
+			break
+		}
+
+		zdo := readZDO(br, db.Version)
+
+		if o.filterZDO == nil || o.filterZDO(zdo) {
+			db.ZDOs = append(db.ZDOs, *zdo)
+		}
+	}
+
+	db.GeneratedZones = []Vector2i{}
+	for range br.int32() {
+		if br.err != nil {
+			break
+		}
+
+		db.GeneratedZones = append(db.GeneratedZones, Vector2i{X: br.int32(), Y: br.int32()})
+	}
+
+	db.PGWVersion = br.int32()
+	db.LocationVersion = br.int32()
+
+	db.GlobalKeys = []string{}
+	for range br.int32() {
+		if br.err != nil {
+			break
+		}
+
+		db.GlobalKeys = append(db.GlobalKeys, br.string())
+	}
+
+	db.LocationsGenerated = br.bool()
+
+	db.Locations = []Location{}
+	for range br.int32() {
+		if br.err != nil {
+			break
+		}
+
+		db.Locations = append(db.Locations, Location{
+			Name:     br.string(),
+			Position: readVector3(br),
+			Placed:   br.bool(),
+		})
+	}
+
+	db.RandomEvent = RandomEvent{
+		Timer:    br.float32(),
+		Name:     br.string(),
+		Time:     br.float32(),
+		Position: readVector3(br),
+	}
+
+	if br.err != nil {
+		return nil, fmt.Errorf("read .db: %w", br.err)
+	}
+
+	return db, nil
+}
+
+const (
+	zdoFlagConnection = 1 << iota
+	zdoFlagFloats
+	zdoFlagVectors
+	zdoFlagQuats
+	zdoFlagInts
+	zdoFlagLongs
+	zdoFlagStrings
+	zdoFlagByteArrays
+	zdoFlagPersistent
+	zdoFlagDistant
+	_
+	_
+	zdoFlagRotation
+
+	zdoTypeShift = 10
+	zdoTypeMask  = 0b11
+)
+
+func readZDO(br *binaryReader, version int32) *ZDO {
+	zdo := &ZDO{
+		ID: ZDOID{
+			UserID: br.int64(),
+			ID:     br.uint32(),
+		},
+	}
+
+	flags := br.uint16()
+
+	zdo.Persistent = flags&zdoFlagPersistent != 0
+	zdo.Distant = flags&zdoFlagDistant != 0
+	zdo.Type = uint8(flags >> zdoTypeShift & zdoTypeMask)
+	zdo.Sector = [2]int16{br.int16(), br.int16()}
+	zdo.Position = readVector3(br)
+	zdo.Prefab = br.int32()
+
+	if flags&zdoFlagRotation != 0 {
+		zdo.Rotation = readVector3(br)
+	}
+
+	if flags&zdoFlagConnection != 0 {
+		zdo.Connection = &ZDOConnection{
+			Type: br.uint8(),
+			Hash: br.int32(),
+		}
+	}
+
+	if flags&zdoFlagFloats != 0 {
+		zdo.Floats = readZDOValues(br, version, (*binaryReader).float32)
+	}
+
+	if flags&zdoFlagVectors != 0 {
+		zdo.Vectors = readZDOValues(br, version, readVector3)
+	}
+
+	if flags&zdoFlagQuats != 0 {
+		zdo.Quats = readZDOValues(br, version, readQuaternion)
+	}
+
+	if flags&zdoFlagInts != 0 {
+		zdo.Ints = readZDOValues(br, version, (*binaryReader).int32)
+	}
+
+	if flags&zdoFlagLongs != 0 {
+		zdo.Longs = readZDOValues(br, version, (*binaryReader).int64)
+	}
+
+	if flags&zdoFlagStrings != 0 {
+		zdo.Strings = readZDOValues(br, version, (*binaryReader).string)
+	}
+
+	if flags&zdoFlagByteArrays != 0 {
+		zdo.ByteArrays = readZDOValues(br, version, func(br *binaryReader) []byte {
+			return br.bytes(int(br.int32()))
+		})
+	}
+
+	return zdo
+}
+
+func readZDOValues[T any](br *binaryReader, version int32, read func(*binaryReader) T) map[int32]T {
+	var (
+		n      = readNumItems(br, version)
+		values = make(map[int32]T, n)
+	)
+
+	for range n {
+		if br.err != nil {
+			break
+		}
+
+		key := br.int32()
+		values[key] = read(br)
+	}
+
+	return values
+}
+
+func readNumItems(br *binaryReader, version int32) int {
+	n := int(br.uint8())
+
+	if version >= worldVersionNumItems && n&0x80 != 0 {
+		n = (n&0x7f)<<8 | int(br.uint8())
+	}
+
+	return n
+}
+
+func readVector3(br *binaryReader) Vector3 {
+	return Vector3{X: br.float32(), Y: br.float32(), Z: br.float32()}
+}
+
+func readQuaternion(br *binaryReader) Quaternion {
+	return Quaternion{X: br.float32(), Y: br.float32(), Z: br.float32(), W: br.float32()}
+}
+
+// StableHashCode is Valheim's string hashing function,
+// used for e.g. prefab names and ZDO value keys.
+func StableHashCode(s string) int32 {
+	var (
+		num  int32 = 5381
+		num2       = num
+	)
+
+	for i := 0; i < len(s) && s[i] != 0; i += 2 {
+		num = ((num << 5) + num) ^ int32(s[i])
+
+		if i == len(s)-1 || s[i+1] == 0 {
+			break
+		}
+
+		num2 = ((num2 << 5) + num2) ^ int32(s[i+1])
+	}
+
+	return num + num2*1566083941
+}
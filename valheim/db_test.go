@@ -0,0 +1,273 @@
+package valheim_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+// dbWriter encodes a .db file the way Valheim's ZPackage does
+// so that ReadDB can be tested without a real world's .db.
+type dbWriter struct {
+	buf     *bytes.Buffer
+	version int32
+}
+
+func (w *dbWriter) write(vs ...any) {
+	for _, v := range vs {
+		_ = binary.Write(w.buf, binary.LittleEndian, v)
+	}
+}
+
+func (w *dbWriter) string(s string) {
+	w.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	w.buf.WriteString(s)
+}
+
+func (w *dbWriter) vector3(v valheim.Vector3) {
+	w.write(v.X, v.Y, v.Z)
+}
+
+func (w *dbWriter) numItems(n int) {
+	if w.version >= 33 && n >= 0x80 {
+		w.write(uint8(n>>8|0x80), uint8(n))
+		return
+	}
+
+	w.write(uint8(n))
+}
+
+func (w *dbWriter) zdo(zdo *valheim.ZDO) {
+	var flags uint16
+
+	if zdo.Connection != nil {
+		flags |= 1 << 0
+	}
+	if len(zdo.Floats) > 0 {
+		flags |= 1 << 1
+	}
+	if len(zdo.Ints) > 0 {
+		flags |= 1 << 4
+	}
+	if len(zdo.Longs) > 0 {
+		flags |= 1 << 5
+	}
+	if len(zdo.Strings) > 0 {
+		flags |= 1 << 6
+	}
+	if len(zdo.ByteArrays) > 0 {
+		flags |= 1 << 7
+	}
+	if zdo.Persistent {
+		flags |= 1 << 8
+	}
+	if zdo.Distant {
+		flags |= 1 << 9
+	}
+	flags |= uint16(zdo.Type) << 10
+	if zdo.Rotation != (valheim.Vector3{}) {
+		flags |= 1 << 12
+	}
+
+	w.write(zdo.ID.UserID, zdo.ID.ID, flags, zdo.Sector[0], zdo.Sector[1])
+	w.vector3(zdo.Position)
+	w.write(zdo.Prefab)
+
+	if zdo.Rotation != (valheim.Vector3{}) {
+		w.vector3(zdo.Rotation)
+	}
+
+	if zdo.Connection != nil {
+		w.write(zdo.Connection.Type, zdo.Connection.Hash)
+	}
+
+	if len(zdo.Floats) > 0 {
+		w.numItems(len(zdo.Floats))
+		for k, v := range zdo.Floats {
+			w.write(k, v)
+		}
+	}
+
+	if len(zdo.Ints) > 0 {
+		w.numItems(len(zdo.Ints))
+		for k, v := range zdo.Ints {
+			w.write(k, v)
+		}
+	}
+
+	if len(zdo.Longs) > 0 {
+		w.numItems(len(zdo.Longs))
+		for k, v := range zdo.Longs {
+			w.write(k, v)
+		}
+	}
+
+	if len(zdo.Strings) > 0 {
+		w.numItems(len(zdo.Strings))
+		for k, v := range zdo.Strings {
+			w.write(k)
+			w.string(v)
+		}
+	}
+
+	if len(zdo.ByteArrays) > 0 {
+		w.numItems(len(zdo.ByteArrays))
+		for k, v := range zdo.ByteArrays {
+			w.write(k, int32(len(v)))
+			w.buf.Write(v)
+		}
+	}
+}
+
+func (w *dbWriter) db(db *valheim.WorldDB) {
+	w.write(db.Version, db.NetTime, db.SessionID, db.NextUID, int32(len(db.ZDOs)))
+	for _, zdo := range db.ZDOs {
+		w.zdo(&zdo)
+	}
+
+	w.write(int32(len(db.GeneratedZones)))
+	for _, zone := range db.GeneratedZones {
+		w.write(zone.X, zone.Y)
+	}
+
+	w.write(db.PGWVersion, db.LocationVersion, int32(len(db.GlobalKeys)))
+	for _, key := range db.GlobalKeys {
+		w.string(key)
+	}
+
+	w.write(db.LocationsGenerated, int32(len(db.Locations)))
+	for _, location := range db.Locations {
+		w.string(location.Name)
+		w.vector3(location.Position)
+		w.write(location.Placed)
+	}
+
+	w.write(db.RandomEvent.Timer)
+	w.string(db.RandomEvent.Name)
+	w.write(db.RandomEvent.Time)
+	w.vector3(db.RandomEvent.Position)
+}
+
+func newWorldDB(version int32) *valheim.WorldDB {
+	// More values than fit in a single byte exercise
+	// the variable-length counts of newer worlds.
+	ints := map[int32]int32{}
+	for i := range int32(200) {
+		ints[i] = i * 2
+	}
+
+	return &valheim.WorldDB{
+		Version:   version,
+		NetTime:   12345.5,
+		SessionID: 987654321,
+		NextUID:   3,
+		ZDOs: []valheim.ZDO{
+			{
+				ID:         valheim.ZDOID{UserID: 42, ID: 1},
+				Sector:     [2]int16{-3, 7},
+				Position:   valheim.Vector3{X: -200.5, Y: 31, Z: 415.25},
+				Rotation:   valheim.Vector3{Y: 90},
+				Prefab:     valheim.StableHashCode("portal_wood"),
+				Persistent: true,
+				Distant:    true,
+				Type:       2,
+				Connection: &valheim.ZDOConnection{Type: 1, Hash: valheim.StableHashCode("target")},
+				Floats:     map[int32]float32{valheim.StableHashCode("health"): 400},
+				Ints:       ints,
+				Longs:      map[int32]int64{valheim.StableHashCode("creator"): 76561198000000000},
+				Strings:    map[int32]string{valheim.StableHashCode("tag"): "home"},
+				ByteArrays: map[int32][]byte{valheim.StableHashCode("items"): {1, 2, 3}},
+			},
+			{
+				ID:       valheim.ZDOID{UserID: 42, ID: 2},
+				Position: valheim.Vector3{X: 1, Y: 2, Z: 3},
+				Prefab:   valheim.StableHashCode("Boar"),
+			},
+		},
+		GeneratedZones:     []valheim.Vector2i{{X: 0, Y: 0}, {X: -1, Y: 2}},
+		PGWVersion:         99,
+		LocationVersion:    26,
+		GlobalKeys:         []string{"defeated_eikthyr"},
+		LocationsGenerated: true,
+		Locations: []valheim.Location{
+			{Name: "Eikthyrnir", Position: valheim.Vector3{X: 100, Y: 30, Z: -50}, Placed: true},
+			{Name: "Vendor_BlackForest", Position: valheim.Vector3{X: -2000, Y: 40, Z: 1500}},
+		},
+		RandomEvent: valheim.RandomEvent{
+			Timer:    60,
+			Name:     "army_eikthyr",
+			Time:     12.5,
+			Position: valheim.Vector3{X: -200, Y: 31, Z: 415},
+		},
+	}
+}
+
+func TestReadDB(t *testing.T) {
+	for _, version := range []int32{32, 34} {
+		expected := newWorldDB(version)
+
+		w := &dbWriter{buf: new(bytes.Buffer), version: version}
+		w.db(expected)
+
+		actual, err := valheim.ReadDB(bytes.NewReader(w.buf.Bytes()))
+		if err != nil {
+			t.Fatalf("failed to read version %d .db: %v", version, err)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("expected version %d .db %+v, got %+v", version, expected, actual)
+		}
+
+		if structures := actual.Structures(); len(structures) != 1 || structures[0].ID != expected.ZDOs[0].ID {
+			t.Fatalf("expected 1 structure %s, got %+v", expected.ZDOs[0].ID, structures)
+		}
+	}
+}
+
+func TestReadDBWithZDOFilter(t *testing.T) {
+	w := &dbWriter{buf: new(bytes.Buffer), version: 34}
+	w.db(newWorldDB(34))
+
+	db, err := valheim.ReadDB(bytes.NewReader(w.buf.Bytes()), valheim.WithoutZDOs)
+	if err != nil {
+		t.Fatalf("failed to read .db: %v", err)
+	}
+
+	if len(db.ZDOs) != 0 {
+		t.Fatalf("expected no ZDOs, got %d", len(db.ZDOs))
+	}
+
+	// Everything after the ZDOs is still read.
+	if db.RandomEvent.Name != "army_eikthyr" {
+		t.Fatalf("expected random event army_eikthyr, got %q", db.RandomEvent.Name)
+	}
+}
+
+func TestReadDBTruncated(t *testing.T) {
+	w := &dbWriter{buf: new(bytes.Buffer), version: 34}
+	w.write(int32(34), float64(0), int64(0), uint32(0), int32(1))
+	w.zdo(&valheim.ZDO{ByteArrays: map[int32][]byte{1: {1, 2, 3}}})
+
+	// Claim that the byte array is far longer than what is left in the file.
+	b := w.buf.Bytes()
+	binary.LittleEndian.PutUint32(b[len(b)-7:], 0x7fffffff)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	if _, err := valheim.ReadDB(bytes.NewReader(b)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected %v reading truncated .db, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("expected reading truncated .db not to trust its lengths, allocated %d bytes", allocated)
+	}
+}
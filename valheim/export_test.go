@@ -0,0 +1,18 @@
+package valheim
+
+// UnityRandomRange exposes unityRandom to valheim_test.
+func UnityRandomRange(seed, lo, hi int32, n int) []int32 {
+	var (
+		r      = newUnityRandom(seed)
+		values = make([]int32, n)
+	)
+
+	for i := range values {
+		values[i] = r.rangeInt(lo, hi)
+	}
+
+	return values
+}
+
+// PerlinNoise exposes perlinNoise to valheim_test.
+var PerlinNoise = perlinNoise
@@ -0,0 +1,133 @@
+package valheim
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	// worldVersionWorldGenVersion is the first world version
+	// whose .fwl contains the world generator version.
+	worldVersionWorldGenVersion = 26
+	// worldVersionNeedsDB is the first world version
+	// whose .fwl contains whether or not it needs a .db.
+	worldVersionNeedsDB = 30
+	// worldVersionStartingGlobalKeys is the first world version
+	// whose .fwl contains the global keys it started with.
+	worldVersionStartingGlobalKeys = 32
+)
+
+// WorldMetadata is the contents of a Valheim world's .fwl file.
+type WorldMetadata struct {
+	Version            int32    `json:"version"`
+	Name               string   `json:"name"`
+	SeedName           string   `json:"seedName"`
+	SeedHash           int32    `json:"seedHash"`
+	UID                int64    `json:"uid"`
+	WorldGenVersion    int32    `json:"worldGenVersion"`
+	NeedsDB            bool     `json:"needsDB"`
+	StartingGlobalKeys []string `json:"startingGlobalKeys"`
+}
+
+// ReadWorldMetadata reads the .fwl file of the given world in the given savedir.
+func ReadWorldMetadata(savedir, world string) (*WorldMetadata, error) {
+	r, err := OpenFWL(savedir, world)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ReadFWL(r)
+}
+
+// ReadFWL decodes the contents of a .fwl file from r.
+func ReadFWL(r io.Reader) (*WorldMetadata, error) {
+	var (
+		br = newBinaryReader(r)
+		// The .fwl file is a single length-prefixed ZPackage.
+		pkg = br.bytes(int(br.int32()))
+	)
+	if br.err != nil {
+		return nil, fmt.Errorf("read .fwl: %w", br.err)
+	}
+
+	var (
+		pr = newBinaryReader(bytes.NewReader(pkg))
+		m  = &WorldMetadata{
+			Version:            pr.int32(),
+			Name:               pr.string(),
+			SeedName:           pr.string(),
+			SeedHash:           pr.int32(),
+			UID:                pr.int64(),
+			StartingGlobalKeys: []string{},
+		}
+	)
+
+	if m.Version >= worldVersionWorldGenVersion {
+		m.WorldGenVersion = pr.int32()
+	}
+
+	if m.Version >= worldVersionNeedsDB {
+		m.NeedsDB = pr.bool()
+	}
+
+	if m.Version >= worldVersionStartingGlobalKeys {
+		for range pr.int32() {
+			if pr.err != nil {
+				break
+			}
+
+			m.StartingGlobalKeys = append(m.StartingGlobalKeys, pr.string())
+		}
+	}
+
+	if pr.err != nil {
+		return nil, fmt.Errorf("read .fwl: %w", pr.err)
+	}
+
+	return m, nil
+}
+
+// WriteFWL encodes m as a .fwl file to w.
+func WriteFWL(w io.Writer, m *WorldMetadata) error {
+	var (
+		buf = new(bytes.Buffer)
+		pw  = &binaryWriter{w: buf}
+	)
+
+	pw.write(m.Version)
+	pw.string(m.Name)
+	pw.string(m.SeedName)
+	pw.write(m.SeedHash)
+	pw.write(m.UID)
+
+	if m.Version >= worldVersionWorldGenVersion {
+		pw.write(m.WorldGenVersion)
+	}
+
+	if m.Version >= worldVersionNeedsDB {
+		pw.bool(m.NeedsDB)
+	}
+
+	if m.Version >= worldVersionStartingGlobalKeys {
+		pw.write(int32(len(m.StartingGlobalKeys)))
+		for _, key := range m.StartingGlobalKeys {
+			pw.string(key)
+		}
+	}
+
+	if pw.err != nil {
+		return fmt.Errorf("write .fwl: %w", pw.err)
+	}
+
+	bw := &binaryWriter{w: w}
+	bw.write(int32(buf.Len()))
+	bw.bytes(buf.Bytes())
+
+	if bw.err != nil {
+		return fmt.Errorf("write .fwl: %w", bw.err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package valheim_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+func TestFWLRoundTrip(t *testing.T) {
+	expected := &valheim.WorldMetadata{
+		Version:            35,
+		Name:               "valheimw",
+		SeedName:           "valheimw",
+		SeedHash:           -1234567890,
+		UID:                1234567890123,
+		WorldGenVersion:    2,
+		NeedsDB:            true,
+		StartingGlobalKeys: []string{"nomap", "playerevents"},
+	}
+
+	buf := new(bytes.Buffer)
+
+	if err := valheim.WriteFWL(buf, expected); err != nil {
+		t.Fatalf("failed to write .fwl: %v", err)
+	}
+
+	actual, err := valheim.ReadFWL(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to read .fwl: %v", err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+
+	seed, err := valheim.ReadSeed(bytes.NewReader(buf.Bytes()), expected.Name)
+	if err != nil {
+		t.Fatalf("failed to read seed: %v", err)
+	}
+
+	if seed != expected.SeedName {
+		t.Fatalf("expected seed %s, got %s", expected.SeedName, seed)
+	}
+}
+
+func TestReadFWLOldVersion(t *testing.T) {
+	expected := &valheim.WorldMetadata{
+		Version:            25,
+		Name:               "old",
+		SeedName:           "abcdefghij",
+		SeedHash:           42,
+		UID:                7,
+		StartingGlobalKeys: []string{},
+	}
+
+	buf := new(bytes.Buffer)
+
+	if err := valheim.WriteFWL(buf, expected); err != nil {
+		t.Fatalf("failed to write .fwl: %v", err)
+	}
+
+	actual, err := valheim.ReadFWL(buf)
+	if err != nil {
+		t.Fatalf("failed to read .fwl: %v", err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestReadFWLTruncated(t *testing.T) {
+	// A length prefix that claims far more than is left in the file.
+	b := []byte{0xff, 0xff, 0xff, 0x7f, 0x01, 0x02}
+
+	if _, err := valheim.ReadFWL(bytes.NewReader(b)); err == nil {
+		t.Fatal("expected error reading truncated .fwl")
+	}
+}
@@ -0,0 +1,255 @@
+package valheim
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WorldFiles are the paths to a world's .fwl and .db files
+// along with the contents of its .fwl.
+type WorldFiles struct {
+	FWL      string
+	DB       string
+	Metadata *WorldMetadata
+}
+
+// ExtractWorlds extracts a tarball of worlds, e.g. one uploaded to be
+// restored, to dir. Since the tarball is not trusted, it errors on
+// anything other than regular files and directories, such as symlinks
+// that later entries could write through, and on names that are
+// absolute or that would otherwise escape dir.
+func ExtractWorlds(tr *tar.Reader, dir string) error {
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("refusing to extract %s: not a relative path within the archive", hdr.Name)
+		}
+
+		path := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractWorldFile(tr, path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("refusing to extract %s: not a regular file or directory", hdr.Name)
+		}
+	}
+}
+
+func extractWorldFile(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// O_EXCL so that a duplicate entry cannot replace a file that
+	// was already extracted, e.g. with one that it is not.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// FindWorld looks through dir for a world's .fwl and .db pair and validates
+// them. If there is more than one, the pair for the given world is preferred.
+func FindWorld(dir, world string) (*WorldFiles, error) {
+	fwls := []string{}
+
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && filepath.Ext(path) == ".fwl" {
+			fwls = append(fwls, path)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	fwl := ""
+	switch len(fwls) {
+	case 0:
+		return nil, fmt.Errorf("no .fwl found")
+	case 1:
+		fwl = fwls[0]
+	default:
+		for _, f := range fwls {
+			if filepath.Base(f) == world+".fwl" {
+				fwl = f
+				break
+			}
+		}
+
+		if fwl == "" {
+			return nil, fmt.Errorf("found %d .fwl files, none of which are for world %s", len(fwls), world)
+		}
+	}
+
+	db := strings.TrimSuffix(fwl, ".fwl") + ".db"
+	if _, err := os.Lstat(db); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no .db found to go with %s", filepath.Base(fwl))
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{fwl, db} {
+		if err := checkRegularFile(name); err != nil {
+			return nil, err
+		}
+	}
+
+	m, err := readFWLFile(fwl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateDBFile(db); err != nil {
+		return nil, err
+	}
+
+	return &WorldFiles{FWL: fwl, DB: db, Metadata: m}, nil
+}
+
+// InstallWorld moves the given world files into savedir
+// as the given world, renaming it if need be.
+//
+// Both files are first staged in a directory that is renamed into place
+// all at once. That rename commits the install, so if the process dies
+// before it, the existing world is untouched and, if it dies after it,
+// CompleteWorldInstall finishes moving the staged files.
+func InstallWorld(wf *WorldFiles, savedir, world string) error {
+	m := *wf.Metadata
+	m.Name = world
+
+	worldsDir := filepath.Join(savedir, "worlds_local")
+
+	if err := os.MkdirAll(worldsDir, 0755); err != nil {
+		return err
+	}
+
+	if err := CompleteWorldInstall(savedir, world); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(worldsDir, "."+world+".install-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	fwl, err := os.Create(filepath.Join(tmp, world+".fwl"))
+	if err != nil {
+		return err
+	}
+	defer fwl.Close()
+
+	if err := WriteFWL(fwl, &m); err != nil {
+		return err
+	}
+
+	if err := fwl.Close(); err != nil {
+		return err
+	}
+
+	// Only a regular file is renamed into the savedir, never
+	// e.g. a symlink to somewhere outside of where it was found.
+	if err := checkRegularFile(wf.DB); err != nil {
+		return err
+	}
+
+	if err := os.Rename(wf.DB, filepath.Join(tmp, world+".db")); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, worldInstallDir(worldsDir, world)); err != nil {
+		return err
+	}
+
+	return CompleteWorldInstall(savedir, world)
+}
+
+// CompleteWorldInstall finishes an install of the given world in savedir
+// that InstallWorld committed but did not get to finish, if any.
+func CompleteWorldInstall(savedir, world string) error {
+	var (
+		worldsDir  = filepath.Join(savedir, "worlds_local")
+		installDir = worldInstallDir(worldsDir, world)
+	)
+
+	// Move the .db first so that the world never has
+	// a new .fwl without its new .db.
+	for _, name := range []string{world + ".db", world + ".fwl"} {
+		if err := os.Rename(filepath.Join(installDir, name), filepath.Join(worldsDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.RemoveAll(installDir)
+}
+
+func worldInstallDir(worldsDir, world string) string {
+	return filepath.Join(worldsDir, "."+world+".install")
+}
+
+// checkRegularFile errors if name is not a regular file, without following symlinks.
+func checkRegularFile(name string) error {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", filepath.Base(name))
+	}
+
+	return nil
+}
+
+func readFWLFile(name string) (*WorldMetadata, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadFWL(f)
+}
+
+func validateDBFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = ReadDB(f, WithoutZDOs)
+	return err
+}
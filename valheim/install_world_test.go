@@ -0,0 +1,275 @@
+package valheim_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+// writeWorld writes a .fwl and .db pair for the given world to dir.
+func writeWorld(t *testing.T, dir, world, seedName string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", dir, err)
+	}
+
+	fwl := new(bytes.Buffer)
+	if err := valheim.WriteFWL(fwl, &valheim.WorldMetadata{
+		Version:  35,
+		Name:     world,
+		SeedName: seedName,
+		SeedHash: valheim.StableHashCode(seedName),
+	}); err != nil {
+		t.Fatalf("failed to write .fwl: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, world+".fwl"), fwl.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write .fwl: %v", err)
+	}
+
+	db := &dbWriter{buf: new(bytes.Buffer), version: 34}
+	db.db(newWorldDB(34))
+
+	if err := os.WriteFile(filepath.Join(dir, world+".db"), db.buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write .db: %v", err)
+	}
+}
+
+// newTar returns a tarball of the given headers, each of which
+// is a regular file whose contents are its name if its Size is unset.
+func newTar(t *testing.T, hdrs ...*tar.Header) *tar.Reader {
+	var (
+		buf = new(bytes.Buffer)
+		tw  = tar.NewWriter(buf)
+	)
+
+	for _, hdr := range hdrs {
+		body := []byte(hdr.Name)
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(body))
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(body); err != nil {
+				t.Fatalf("failed to write tar body: %v", err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+
+	return tar.NewReader(buf)
+}
+
+func TestExtractWorlds(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := valheim.ExtractWorlds(newTar(t,
+		&tar.Header{Typeflag: tar.TypeDir, Name: "worlds_local/", Mode: 0755},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "worlds_local/Dedicated.fwl", Mode: 0644},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "Dedicated.db", Mode: 0644},
+	), dir); err != nil {
+		t.Fatalf("failed to extract worlds: %v", err)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(dir, "worlds_local", "Dedicated.fwl")); err != nil {
+		t.Fatalf("failed to read extracted .fwl: %v", err)
+	} else if string(b) != "worlds_local/Dedicated.fwl" {
+		t.Fatalf("expected extracted .fwl to contain its name, got %q", b)
+	}
+
+	outside := t.TempDir()
+
+	for name, hdrs := range map[string][]*tar.Header{
+		"symlink": {
+			{Typeflag: tar.TypeSymlink, Name: "link", Linkname: outside},
+			{Typeflag: tar.TypeReg, Name: "link/Dedicated.db", Mode: 0644},
+		},
+		"hard link": {
+			{Typeflag: tar.TypeLink, Name: "Dedicated.db", Linkname: "/etc/passwd"},
+		},
+		"absolute": {
+			{Typeflag: tar.TypeReg, Name: filepath.Join(outside, "Dedicated.db"), Mode: 0644},
+		},
+		"parent": {
+			{Typeflag: tar.TypeReg, Name: "../Dedicated.db", Mode: 0644},
+		},
+		"duplicate": {
+			{Typeflag: tar.TypeReg, Name: "Dedicated.db", Mode: 0644},
+			{Typeflag: tar.TypeReg, Name: "Dedicated.db", Mode: 0644},
+		},
+	} {
+		if err := valheim.ExtractWorlds(newTar(t, hdrs...), t.TempDir()); err == nil {
+			t.Fatalf("expected error extracting worlds with %s", name)
+		}
+	}
+
+	if entries, err := os.ReadDir(outside); err != nil {
+		t.Fatalf("failed to read %s: %v", outside, err)
+	} else if len(entries) != 0 {
+		t.Fatalf("expected nothing to be extracted outside of the directory, got %v", entries)
+	}
+}
+
+func TestFindWorld(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := valheim.FindWorld(dir, "Dedicated"); err == nil {
+		t.Fatal("expected error finding world in empty directory")
+	}
+
+	writeWorld(t, filepath.Join(dir, "a"), "Friends", "abcdefghij")
+
+	wf, err := valheim.FindWorld(dir, "Dedicated")
+	if err != nil {
+		t.Fatalf("failed to find only world: %v", err)
+	}
+
+	if wf.Metadata.Name != "Friends" {
+		t.Fatalf("expected world Friends, got %s", wf.Metadata.Name)
+	}
+
+	writeWorld(t, filepath.Join(dir, "b"), "Dedicated", "klmnopqrst")
+
+	if wf, err = valheim.FindWorld(dir, "Dedicated"); err != nil {
+		t.Fatalf("failed to find preferred world: %v", err)
+	} else if wf.Metadata.SeedName != "klmnopqrst" {
+		t.Fatalf("expected seed klmnopqrst, got %s", wf.Metadata.SeedName)
+	}
+
+	if _, err := valheim.FindWorld(dir, "Other"); err == nil {
+		t.Fatal("expected error finding world among several that are not it")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a", "Friends.db")); err != nil {
+		t.Fatalf("failed to remove .db: %v", err)
+	}
+
+	if _, err := valheim.FindWorld(filepath.Join(dir, "a"), "Friends"); err == nil {
+		t.Fatal("expected error finding world without a .db")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "b", "Dedicated.db"), []byte("not a .db"), 0644); err != nil {
+		t.Fatalf("failed to write .db: %v", err)
+	}
+
+	if _, err := valheim.FindWorld(filepath.Join(dir, "b"), "Dedicated"); err == nil {
+		t.Fatal("expected error finding world with an invalid .db")
+	}
+
+	writeWorld(t, filepath.Join(dir, "c"), "Dedicated", "abcdefghij")
+
+	if err := os.Symlink(filepath.Join(dir, "c", "Dedicated.db"), filepath.Join(dir, "a", "Friends.db")); err != nil {
+		t.Fatalf("failed to symlink .db: %v", err)
+	}
+
+	if _, err := valheim.FindWorld(filepath.Join(dir, "a"), "Friends"); err == nil {
+		t.Fatal("expected error finding world with a symlinked .db")
+	}
+}
+
+func TestInstallWorld(t *testing.T) {
+	var (
+		restoreDir = t.TempDir()
+		savedir    = t.TempDir()
+	)
+
+	writeWorld(t, filepath.Join(savedir, "worlds_local"), "Dedicated", "abcdefghij")
+	writeWorld(t, restoreDir, "Friends", "klmnopqrst")
+
+	wf, err := valheim.FindWorld(restoreDir, "Dedicated")
+	if err != nil {
+		t.Fatalf("failed to find world: %v", err)
+	}
+
+	if err := valheim.InstallWorld(wf, savedir, "Dedicated"); err != nil {
+		t.Fatalf("failed to install world: %v", err)
+	}
+
+	m, err := valheim.ReadWorldMetadata(savedir, "Dedicated")
+	if err != nil {
+		t.Fatalf("failed to read installed world: %v", err)
+	}
+
+	// The world is renamed to the one it was installed as.
+	if m.Name != "Dedicated" || m.SeedName != "klmnopqrst" {
+		t.Fatalf("expected world Dedicated with seed klmnopqrst, got %s with %s", m.Name, m.SeedName)
+	}
+
+	if _, err := valheim.ReadWorldDB(savedir, "Dedicated", valheim.WithoutZDOs); err != nil {
+		t.Fatalf("failed to read installed .db: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(savedir, "worlds_local"))
+	if err != nil {
+		t.Fatalf("failed to read worlds: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected only the world's .fwl and .db to be left, got %v", entries)
+	}
+
+	writeWorld(t, restoreDir, "Friends", "klmnopqrst")
+
+	if wf, err = valheim.FindWorld(restoreDir, "Dedicated"); err != nil {
+		t.Fatalf("failed to find world: %v", err)
+	}
+
+	if err := os.Remove(wf.DB); err != nil {
+		t.Fatalf("failed to remove .db: %v", err)
+	}
+
+	if err := os.Symlink(filepath.Join(savedir, "worlds_local", "Dedicated.db"), wf.DB); err != nil {
+		t.Fatalf("failed to symlink .db: %v", err)
+	}
+
+	if err := valheim.InstallWorld(wf, savedir, "Dedicated"); err == nil {
+		t.Fatal("expected error installing world with a symlinked .db")
+	}
+}
+
+func TestCompleteWorldInstall(t *testing.T) {
+	var (
+		savedir    = t.TempDir()
+		worldsDir  = filepath.Join(savedir, "worlds_local")
+		installDir = filepath.Join(worldsDir, ".Dedicated.install")
+	)
+
+	writeWorld(t, worldsDir, "Dedicated", "abcdefghij")
+
+	// Nothing to complete.
+	if err := valheim.CompleteWorldInstall(savedir, "Dedicated"); err != nil {
+		t.Fatalf("failed to complete world install: %v", err)
+	}
+
+	// An install that was committed, but that
+	// only got as far as moving the .db into place.
+	writeWorld(t, installDir, "Dedicated", "klmnopqrst")
+
+	if err := os.Rename(filepath.Join(installDir, "Dedicated.db"), filepath.Join(worldsDir, "Dedicated.db")); err != nil {
+		t.Fatalf("failed to move .db: %v", err)
+	}
+
+	if err := valheim.CompleteWorldInstall(savedir, "Dedicated"); err != nil {
+		t.Fatalf("failed to complete world install: %v", err)
+	}
+
+	if m, err := valheim.ReadWorldMetadata(savedir, "Dedicated"); err != nil {
+		t.Fatalf("failed to read installed world: %v", err)
+	} else if m.SeedName != "klmnopqrst" {
+		t.Fatalf("expected seed klmnopqrst, got %s", m.SeedName)
+	}
+
+	if _, err := os.Stat(installDir); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", installDir, err)
+	}
+}
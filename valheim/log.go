@@ -0,0 +1,342 @@
+package valheim
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/logutil"
+)
+
+const (
+	maxLogLineLength = 64 * 1024
+	logTimeLayout    = "01/02/2006 15:04:05"
+)
+
+// lineWriter writes through to w and calls fn
+// with each complete line that is written to it.
+type lineWriter struct {
+	w   io.Writer
+	fn  func(string)
+	buf []byte
+}
+
+func newLineWriter(w io.Writer, fn func(string)) *lineWriter {
+	return &lineWriter{w: w, fn: fn}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if l.w != nil {
+		var err error
+		if n, err = l.w.Write(p); err != nil {
+			return n, err
+		}
+	}
+
+	l.buf = append(l.buf, p[:n]...)
+
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		l.fn(strings.TrimRight(string(l.buf[:i]), "\r"))
+		l.buf = l.buf[i+1:]
+	}
+
+	// Don't buffer forever if something
+	// never writes a newline.
+	if len(l.buf) > maxLogLineLength {
+		l.fn(string(l.buf))
+		l.buf = nil
+	}
+
+	return n, nil
+}
+
+// EventType is the kind of thing that an Event describes.
+type EventType string
+
+const (
+	// EventPlayerConnected is a player's client connecting.
+	// Its Name is not yet known.
+	EventPlayerConnected EventType = "player_connected"
+	// EventPlayerJoined is a player's character spawning
+	// into the world for the first time after connecting.
+	EventPlayerJoined EventType = "player_joined"
+	// EventPlayerSpawned is a player's character
+	// respawning into the world, e.g. after dying.
+	EventPlayerSpawned EventType = "player_spawned"
+	// EventPlayerDisconnected is a player's client disconnecting.
+	EventPlayerDisconnected EventType = "player_disconnected"
+	// EventWorldSaved is the world being saved to disk.
+	EventWorldSaved EventType = "world_saved"
+	// EventServerConnected is the server finishing
+	// loading the world and connecting to Steam.
+	EventServerConnected EventType = "server_connected"
+	// EventRandomEvent is a random event, e.g. a raid, starting.
+	EventRandomEvent EventType = "random_event"
+	// EventDay is the in-game day changing because players slept.
+	EventDay EventType = "day"
+	// EventError is the server logging an error.
+	EventError EventType = "error"
+	// EventServerStopped is the Valheim server process
+	// exiting because it was asked to. It is not parsed
+	// from a log line, but published by a Server.
+	EventServerStopped EventType = "server_stopped"
+	// EventServerExited is the Valheim server process
+	// exiting on its own, e.g. because it crashed. It is
+	// not parsed from a log line, but published by a Server.
+	EventServerExited EventType = "server_exited"
+)
+
+// Event is something that happened according to the Valheim server's logs.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// PlatformID identifies a player's account,
+	// e.g. "Steam_76561198000000000".
+	PlatformID string `json:"platformId,omitempty"`
+	// Name is a player's character name.
+	Name string `json:"name,omitempty"`
+	// ZDOID is a player's character's ZDOID.
+	ZDOID *ZDOID `json:"zdoid,omitempty"`
+	// Duration is how long the world took to save.
+	Duration time.Duration `json:"duration,omitempty"`
+	// RandomEvent is the name of the random event, e.g. "army_eikthyr".
+	RandomEvent string `json:"randomEvent,omitempty"`
+	// Day is the new in-game day.
+	Day int64 `json:"day,omitempty"`
+	// Error is why the Valheim server process exited.
+	Error string `json:"error,omitempty"`
+	// Line is the log line that the Event was parsed from.
+	Line string `json:"line,omitempty"`
+}
+
+var (
+	logTimeRegexp          = regexp.MustCompile(`^(\d{2}/\d{2}/\d{4} \d{2}:\d{2}:\d{2}): (.*)$`)
+	gotConnectionRegexp    = regexp.MustCompile(`Got connection SteamID (\d+)`)
+	platformIDRegexp       = regexp.MustCompile(`received local Platform ID ((?:Steam|Xbox|None)_\w+)`)
+	gotCharacterRegexp     = regexp.MustCompile(`Got character ZDOID from (.+) : (-?\d+):(\d+)`)
+	closingSocketRegexp    = regexp.MustCompile(`Closing socket (\S+)`)
+	worldSavedRegexp       = regexp.MustCompile(`World saved \( ?([\d.]+) ?ms ?\)`)
+	randomEventRegexp      = regexp.MustCompile(`Random event set:\s*(\S+)`)
+	dayRegexp              = regexp.MustCompile(`Time [\d.]+, day:(\d+)`)
+	bepInExLevelRegexp     = regexp.MustCompile(`^\[(\w+)\s*:`)
+	unityFilenameLogPrefix = "(Filename:"
+)
+
+// LogParser parses the Valheim server's log lines into Events,
+// keeping track of which player is which across lines.
+// The zero value is ready to use.
+type LogParser struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	// pending are the platform IDs of players who
+	// have connected but whose character has not yet spawned.
+	pending []string
+	// names are the character names of connected players
+	// keyed by platform ID.
+	names  map[string]string
+	joined map[string]bool
+}
+
+// Subscribe returns a channel that receives every Event
+// parsed by p until ctx is done, at which point it is closed.
+// Events are dropped rather than blocking the Valheim server's
+// logs if the channel's buffer is full.
+func (p *LogParser) Subscribe(ctx context.Context, buffer int) <-chan Event {
+	ch := make(chan Event, buffer)
+
+	p.mu.Lock()
+	if p.subscribers == nil {
+		p.subscribers = map[chan Event]struct{}{}
+	}
+	p.subscribers[ch] = struct{}{}
+	p.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		p.mu.Lock()
+		delete(p.subscribers, ch)
+		close(ch)
+		p.mu.Unlock()
+	}()
+
+	return ch
+}
+
+// Handle re-emits line via the logger in ctx and
+// sends the Event parsed from it, if any, to subscribers.
+func (p *LogParser) Handle(ctx context.Context, line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	_, msg := splitLogTime(line)
+	logutil.SloggerFrom(ctx).Log(ctx, logLevel(msg), msg, "process", "valheim")
+
+	if event := p.Parse(line); event != nil {
+		p.publish(ctx, event)
+	}
+}
+
+func (p *LogParser) publish(ctx context.Context, event *Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for ch := range p.subscribers {
+		select {
+		case ch <- *event:
+		default:
+			logutil.SloggerFrom(ctx).Debug("dropping event for slow subscriber", "type", event.Type)
+		}
+	}
+}
+
+// Parse parses an Event from line, returning nil
+// if line does not describe anything interesting.
+func (p *LogParser) Parse(line string) *Event {
+	t, msg := splitLogTime(line)
+
+	event := &Event{Time: t, Line: line}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.names == nil {
+		p.names = map[string]string{}
+		p.joined = map[string]bool{}
+	}
+
+	switch {
+	case gotConnectionRegexp.MatchString(msg):
+		event.Type = EventPlayerConnected
+		event.PlatformID = "Steam_" + gotConnectionRegexp.FindStringSubmatch(msg)[1]
+		p.pending = append(p.pending, event.PlatformID)
+	case platformIDRegexp.MatchString(msg):
+		event.Type = EventPlayerConnected
+		event.PlatformID = platformIDRegexp.FindStringSubmatch(msg)[1]
+		p.pending = append(p.pending, event.PlatformID)
+	case gotCharacterRegexp.MatchString(msg):
+		var (
+			matches   = gotCharacterRegexp.FindStringSubmatch(msg)
+			userID, _ = strconv.ParseInt(matches[2], 10, 64)
+			id, _     = strconv.ParseUint(matches[3], 10, 32)
+		)
+
+		// A ZDOID of 0:0 means that the character died.
+		if userID == 0 && id == 0 {
+			return nil
+		}
+
+		event.Name = matches[1]
+		event.ZDOID = &ZDOID{UserID: userID, ID: uint32(id)}
+
+		// Respawns are logged the same way, so only the
+		// first character after a connection is a join.
+		for platformID, name := range p.names {
+			if name == event.Name && p.joined[platformID] {
+				event.Type = EventPlayerSpawned
+				event.PlatformID = platformID
+				return event
+			}
+		}
+
+		event.Type = EventPlayerJoined
+		if len(p.pending) > 0 {
+			event.PlatformID = p.pending[0]
+			p.pending = p.pending[1:]
+			p.names[event.PlatformID] = event.Name
+			p.joined[event.PlatformID] = true
+		}
+	case closingSocketRegexp.MatchString(msg):
+		id := closingSocketRegexp.FindStringSubmatch(msg)[1]
+
+		event.Type = EventPlayerDisconnected
+		event.PlatformID = id
+		if _, err := strconv.ParseUint(id, 10, 64); err == nil {
+			event.PlatformID = "Steam_" + id
+		}
+		event.Name = p.names[event.PlatformID]
+
+		delete(p.names, event.PlatformID)
+		delete(p.joined, event.PlatformID)
+		for i, platformID := range p.pending {
+			if platformID == event.PlatformID {
+				p.pending = append(p.pending[:i], p.pending[i+1:]...)
+				break
+			}
+		}
+	case worldSavedRegexp.MatchString(msg):
+		event.Type = EventWorldSaved
+		if ms, err := strconv.ParseFloat(worldSavedRegexp.FindStringSubmatch(msg)[1], 64); err == nil {
+			event.Duration = time.Duration(ms * float64(time.Millisecond))
+		}
+	case strings.Contains(msg, ReadyLogLine):
+		event.Type = EventServerConnected
+	case randomEventRegexp.MatchString(msg):
+		event.Type = EventRandomEvent
+		event.RandomEvent = randomEventRegexp.FindStringSubmatch(msg)[1]
+	case dayRegexp.MatchString(msg):
+		event.Type = EventDay
+		event.Day, _ = strconv.ParseInt(dayRegexp.FindStringSubmatch(msg)[1], 10, 64)
+	case logLevel(msg) >= slog.LevelError:
+		event.Type = EventError
+	default:
+		return nil
+	}
+
+	return event
+}
+
+// splitLogTime splits the timestamp that the Valheim
+// server prefixes most of its log lines with from the
+// rest of the line. If there isn't one, the current
+// time is returned.
+func splitLogTime(line string) (time.Time, string) {
+	if matches := logTimeRegexp.FindStringSubmatch(line); matches != nil {
+		if t, err := time.ParseInLocation(logTimeLayout, matches[1], time.Local); err == nil {
+			return t, matches[2]
+		}
+	}
+
+	return time.Now(), line
+}
+
+// logLevel guesses the level of a line logged by
+// the Valheim server, Unity or BepInEx.
+func logLevel(msg string) slog.Level {
+	if matches := bepInExLevelRegexp.FindStringSubmatch(msg); matches != nil {
+		switch strings.ToLower(matches[1]) {
+		case "fatal", "error":
+			return slog.LevelError
+		case "warning":
+			return slog.LevelWarn
+		case "debug":
+			return slog.LevelDebug
+		case "info", "message":
+			return slog.LevelInfo
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(msg, unityFilenameLogPrefix):
+		return slog.LevelDebug
+	case strings.Contains(msg, "Exception"), strings.HasPrefix(msg, "ERROR"), strings.HasPrefix(msg, "Error"):
+		return slog.LevelError
+	case strings.HasPrefix(msg, "WARNING"), strings.HasPrefix(msg, "Warning"):
+		return slog.LevelWarn
+	}
+
+	return slog.LevelInfo
+}
@@ -0,0 +1,86 @@
+package valheim_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+func TestLogParserParse(t *testing.T) {
+	var (
+		p     = &valheim.LogParser{}
+		lines = []string{
+			"10/17/2026 17:00:00: Game server connected",
+			"10/17/2026 17:01:00: Got connection SteamID 76561198000000001",
+			"10/17/2026 17:01:05: Got character ZDOID from Ragnar : 123456789:1",
+			"10/17/2026 17:02:00: Connections 1 ZDOS:12345  sent:0 recv:0",
+			"10/17/2026 17:03:00: Got character ZDOID from Ragnar : 0:0",
+			"10/17/2026 17:03:10: Got character ZDOID from Ragnar : 123456789:2",
+			"10/17/2026 17:04:00: Random event set:army_eikthyr",
+			"10/17/2026 17:05:00: World saved ( 123.5ms )",
+			"10/17/2026 17:06:00: Time 2160.5, day:2    nextm:3600  skipspeed:12.3",
+			"10/17/2026 17:07:00: Closing socket 76561198000000001",
+			"[Error  : Unity Log] NullReferenceException: Object reference not set to an instance of an object",
+		}
+		expected = []valheim.Event{
+			{Type: valheim.EventServerConnected},
+			{Type: valheim.EventPlayerConnected, PlatformID: "Steam_76561198000000001"},
+			{Type: valheim.EventPlayerJoined, PlatformID: "Steam_76561198000000001", Name: "Ragnar", ZDOID: &valheim.ZDOID{UserID: 123456789, ID: 1}},
+			{Type: valheim.EventPlayerSpawned, PlatformID: "Steam_76561198000000001", Name: "Ragnar", ZDOID: &valheim.ZDOID{UserID: 123456789, ID: 2}},
+			{Type: valheim.EventRandomEvent, RandomEvent: "army_eikthyr"},
+			{Type: valheim.EventWorldSaved, Duration: 123500 * time.Microsecond},
+			{Type: valheim.EventDay, Day: 2},
+			{Type: valheim.EventPlayerDisconnected, PlatformID: "Steam_76561198000000001", Name: "Ragnar"},
+			{Type: valheim.EventError},
+		}
+		events = []valheim.Event{}
+	)
+
+	for _, line := range lines {
+		if event := p.Parse(line); event != nil {
+			events = append(events, *event)
+		}
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+
+	for i, event := range events {
+		e := expected[i]
+
+		if event.Type != e.Type || event.PlatformID != e.PlatformID || event.Name != e.Name || event.RandomEvent != e.RandomEvent || event.Day != e.Day || event.Duration != e.Duration {
+			t.Fatalf("expected event %d to be %+v, got %+v", i, e, event)
+		}
+
+		if (e.ZDOID == nil) != (event.ZDOID == nil) || (e.ZDOID != nil && *e.ZDOID != *event.ZDOID) {
+			t.Fatalf("expected event %d ZDOID to be %v, got %v", i, e.ZDOID, event.ZDOID)
+		}
+	}
+
+	if expected := time.Date(2026, 10, 17, 17, 0, 0, 0, time.Local); !events[0].Time.Equal(expected) {
+		t.Fatalf("expected time %s, got %s", expected, events[0].Time)
+	}
+}
+
+func TestLogParserSubscribe(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		p           = &valheim.LogParser{}
+		events      = p.Subscribe(ctx, 1)
+	)
+
+	p.Handle(ctx, "World saved ( 1.0ms )")
+
+	if event := <-events; event.Type != valheim.EventWorldSaved {
+		t.Fatalf("expected %s event, got %s", valheim.EventWorldSaved, event.Type)
+	}
+
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed")
+	}
+}
@@ -0,0 +1,144 @@
+package valheim
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// MaxMapTileZoom is the deepest zoom that ParseMapTile accepts.
+const MaxMapTileZoom = 8
+
+var (
+	biomeColors = map[Biome]color.RGBA{
+		BiomeMeadows:     {0x8d, 0xb3, 0x4e, 0xff},
+		BiomeSwamp:       {0x6b, 0x5a, 0x3c, 0xff},
+		BiomeMountain:    {0xdc, 0xe3, 0xeb, 0xff},
+		BiomeBlackForest: {0x3a, 0x5c, 0x2f, 0xff},
+		BiomePlains:      {0xd6, 0xc2, 0x6d, 0xff},
+		BiomeAshLands:    {0x8c, 0x2f, 0x1e, 0xff},
+		BiomeDeepNorth:   {0xcf, 0xe4, 0xf5, 0xff},
+		BiomeOcean:       {0x2a, 0x5d, 0x8f, 0xff},
+		BiomeMistlands:   {0x5c, 0x4b, 0x6e, 0xff},
+	}
+	// MarkerColor is the default color that markers are drawn with.
+	MarkerColor = color.RGBA{0xff, 0x30, 0x30, 0xff}
+)
+
+// MapRect is an area of the world in world coordinates.
+// X increases to the east and Z increases to the north.
+type MapRect struct {
+	MinX, MinZ, MaxX, MaxZ float64
+}
+
+// WorldMapRect is the area of the entire world.
+var WorldMapRect = MapRect{-WorldRadius, -WorldRadius, WorldRadius, WorldRadius}
+
+// MapTileRect returns the area of the world covered by the given
+// slippy map tile. At zoom 0, a single tile covers the entire world.
+func MapTileRect(zoom, x, y int) MapRect {
+	var (
+		tiles = float64(int(1) << zoom)
+		size  = 2 * WorldRadius / tiles
+		minX  = -WorldRadius + float64(x)*size
+		maxZ  = WorldRadius - float64(y)*size
+	)
+
+	return MapRect{minX, maxZ - size, minX + size, maxZ}
+}
+
+// ParseMapTile parses a slippy map tile's path, e.g. "3/2/5.png",
+// into its zoom, x and y, erroring if the tile is not in the world.
+func ParseMapTile(name string) (zoom, x, y int, err error) {
+	if _, err = fmt.Sscanf(name, "%d/%d/%d.png", &zoom, &x, &y); err != nil {
+		return 0, 0, 0, fmt.Errorf("parse map tile %s: %w", name, err)
+	}
+
+	// Check the zoom before using it as a shift count, which must not be negative.
+	if zoom < 0 || zoom > MaxMapTileZoom {
+		return 0, 0, 0, fmt.Errorf("map tile zoom %d is not between 0 and %d", zoom, MaxMapTileZoom)
+	}
+
+	if n := 1 << zoom; x < 0 || x >= n || y < 0 || y >= n {
+		return 0, 0, 0, fmt.Errorf("map tile %d/%d/%d is out of bounds", zoom, x, y)
+	}
+
+	return zoom, x, y, nil
+}
+
+// RenderMap renders the biomes of the given area of the world
+// to a size by size image, north up.
+func (g *WorldGenerator) RenderMap(rect MapRect, size int) *image.RGBA {
+	var (
+		img = image.NewRGBA(image.Rect(0, 0, size, size))
+		dx  = (rect.MaxX - rect.MinX) / float64(size)
+		dz  = (rect.MaxZ - rect.MinZ) / float64(size)
+	)
+
+	for py := range size {
+		z := rect.MaxZ - (float64(py)+0.5)*dz
+
+		for px := range size {
+			x := rect.MinX + (float64(px)+0.5)*dx
+
+			if math.Hypot(x, z) > WorldRadius {
+				continue
+			}
+
+			img.SetRGBA(px, py, g.color(x, z))
+		}
+	}
+
+	return img
+}
+
+func (g *WorldGenerator) color(x, z float64) color.RGBA {
+	var (
+		biome = g.Biome(x, z)
+		c     = biomeColors[biome]
+		h     = g.BaseHeight(x, z)
+		shade float64
+	)
+
+	if biome == BiomeOcean {
+		// Deeper water is darker.
+		shade = 0.4 + 0.6*clamp01(1+h*4)
+	} else {
+		// Higher land is lighter.
+		shade = 0.85 + 0.3*clamp01(h)
+	}
+
+	return color.RGBA{
+		R: uint8(math.Min(float64(c.R)*shade, 0xff)),
+		G: uint8(math.Min(float64(c.G)*shade, 0xff)),
+		B: uint8(math.Min(float64(c.B)*shade, 0xff)),
+		A: c.A,
+	}
+}
+
+// DrawMarkers draws a marker on img, which was rendered from
+// rect, at each of the given world positions.
+func DrawMarkers(img *image.RGBA, rect MapRect, c color.Color, positions ...Vector3) {
+	var (
+		bounds = img.Bounds()
+		sx     = float64(bounds.Dx()) / (rect.MaxX - rect.MinX)
+		sz     = float64(bounds.Dy()) / (rect.MaxZ - rect.MinZ)
+		radius = max(1, bounds.Dx()/512)
+	)
+
+	for _, pos := range positions {
+		var (
+			px = bounds.Min.X + int((float64(pos.X)-rect.MinX)*sx)
+			py = bounds.Min.Y + int((rect.MaxZ-float64(pos.Z))*sz)
+		)
+
+		for y := py - radius; y <= py+radius; y++ {
+			for x := px - radius; x <= px+radius; x++ {
+				if image.Pt(x, y).In(bounds) {
+					img.Set(x, y, c)
+				}
+			}
+		}
+	}
+}
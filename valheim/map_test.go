@@ -0,0 +1,32 @@
+package valheim_test
+
+import (
+	"testing"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+func TestParseMapTile(t *testing.T) {
+	z, x, y, err := valheim.ParseMapTile("3/2/5.png")
+	if err != nil {
+		t.Fatalf("failed to parse map tile: %v", err)
+	}
+
+	if z != 3 || x != 2 || y != 5 {
+		t.Fatalf("expected 3/2/5, got %d/%d/%d", z, x, y)
+	}
+
+	for _, name := range []string{
+		"-1/0/0.png",
+		"-64/0/0.png",
+		"9/0/0.png",
+		"1/2/0.png",
+		"1/0/-1.png",
+		"0/0/0.jpg",
+		"tile.png",
+	} {
+		if _, _, _, err := valheim.ParseMapTile(name); err == nil {
+			t.Fatalf("expected error parsing map tile %s", name)
+		}
+	}
+}
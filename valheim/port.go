@@ -0,0 +1,66 @@
+package valheim
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPort is the port that the Valheim server
+	// listens on if Opts does not specify one.
+	DefaultPort = 2456
+)
+
+// udpPortBound reports whether something is bound to the given
+// UDP port according to /proc/net. If that cannot be determined,
+// e.g. because /proc is not available, it reports true.
+func udpPortBound(port int64) bool {
+	var (
+		found   bool
+		checked bool
+	)
+
+	for _, name := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		f, err := os.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return true
+		}
+
+		checked = true
+
+		scanner := bufio.NewScanner(f)
+		// Skip the header.
+		scanner.Scan()
+
+		for scanner.Scan() {
+			// e.g. "0: 00000000:0998 00000000:0000 07 ..."
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 {
+				continue
+			}
+
+			_, hexPort, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+
+			if p, err := strconv.ParseInt(hexPort, 16, 64); err == nil && p == port {
+				found = true
+				break
+			}
+		}
+
+		_ = f.Close()
+
+		if found {
+			return true
+		}
+	}
+
+	return !checked
+}
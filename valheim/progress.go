@@ -0,0 +1,84 @@
+package valheim
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// DayLength is the length of an in-game day.
+	DayLength = 30 * time.Minute
+)
+
+// Boss is a Valheim boss along with the global key
+// that gets set when it is defeated.
+type Boss struct {
+	Name      string `json:"name"`
+	GlobalKey string `json:"globalKey"`
+}
+
+var (
+	BossEikthyr  = Boss{Name: "Eikthyr", GlobalKey: "defeated_eikthyr"}
+	BossTheElder = Boss{Name: "The Elder", GlobalKey: "defeated_gdking"}
+	BossBonemass = Boss{Name: "Bonemass", GlobalKey: "defeated_bonemass"}
+	BossModer    = Boss{Name: "Moder", GlobalKey: "defeated_dragon"}
+	BossYagluth  = Boss{Name: "Yagluth", GlobalKey: "defeated_goblinking"}
+	BossTheQueen = Boss{Name: "The Queen", GlobalKey: "defeated_queen"}
+	BossFader    = Boss{Name: "Fader", GlobalKey: "defeated_fader"}
+
+	// Bosses are Valheim's bosses in the order
+	// that they are intended to be defeated.
+	Bosses = []Boss{
+		BossEikthyr,
+		BossTheElder,
+		BossBonemass,
+		BossModer,
+		BossYagluth,
+		BossTheQueen,
+		BossFader,
+	}
+)
+
+// BossProgress is whether or not a boss has been defeated.
+type BossProgress struct {
+	Boss
+	Defeated bool `json:"defeated"`
+}
+
+// Progress is a summary of how far along a world is.
+type Progress struct {
+	Day        int64          `json:"day"`
+	Bosses     []BossProgress `json:"bosses"`
+	GlobalKeys []string       `json:"globalKeys"`
+}
+
+// Day returns the in-game day that the world is on.
+func (w *WorldDB) Day() int64 {
+	return int64(w.NetTime / DayLength.Seconds())
+}
+
+// HasGlobalKey reports whether or not the given global key is set in the world.
+func (w *WorldDB) HasGlobalKey(key string) bool {
+	return slices.ContainsFunc(w.GlobalKeys, func(globalKey string) bool {
+		return strings.EqualFold(globalKey, key)
+	})
+}
+
+// Progress summarizes how far along the world is.
+func (w *WorldDB) Progress() *Progress {
+	progress := &Progress{
+		Day:        w.Day(),
+		Bosses:     make([]BossProgress, len(Bosses)),
+		GlobalKeys: w.GlobalKeys,
+	}
+
+	for i, boss := range Bosses {
+		progress.Bosses[i] = BossProgress{
+			Boss:     boss,
+			Defeated: w.HasGlobalKey(boss.GlobalKey),
+		}
+	}
+
+	return progress
+}
@@ -0,0 +1,238 @@
+package valheim
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/logutil"
+)
+
+const (
+	// SessionsFile is the name of the file in the Valheim
+	// savedir that a Roster keeps its session history in.
+	SessionsFile = "sessions.jsonl"
+)
+
+// Player is a player that is connected to the Valheim server.
+type Player struct {
+	// PlatformID identifies the player's account,
+	// e.g. "Steam_76561198000000000".
+	PlatformID string `json:"platformId"`
+	// Platform is the platform that the player is
+	// playing on, e.g. "Steam" or "Xbox".
+	Platform string `json:"platform,omitempty"`
+	// Name is the player's character name. It is
+	// empty until the player's character spawns.
+	Name        string    `json:"name,omitempty"`
+	ZDOID       *ZDOID    `json:"zdoid,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// Session is a span of time that a Player was connected.
+type Session struct {
+	Player
+	DisconnectedAt time.Time `json:"disconnectedAt"`
+	Duration       string    `json:"duration"`
+}
+
+// Roster keeps track of which players are connected to the Valheim
+// server and appends each Session to a history file once it ends.
+type Roster struct {
+	// Path is the file that the session history is kept in.
+	// If empty, no history is kept.
+	Path string
+
+	mu      sync.Mutex
+	players map[string]*Player
+}
+
+// NewRoster returns a Roster that keeps its
+// session history in the given savedir.
+func NewRoster(savedir string) *Roster {
+	return &Roster{Path: filepath.Join(savedir, SessionsFile)}
+}
+
+// Run updates r from events until ctx is done or events
+// is closed, at which point every open Session is ended.
+// Failing to write the session history is logged rather
+// than returned, since the Roster keeps working without it.
+func (r *Roster) Run(ctx context.Context, events <-chan Event) error {
+	log := logutil.SloggerFrom(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.endAll(time.Now()); err != nil {
+				log.Error("writing session history", "path", r.Path, "err", err)
+			}
+
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				if err := r.endAll(time.Now()); err != nil {
+					log.Error("writing session history", "path", r.Path, "err", err)
+				}
+
+				return nil
+			}
+
+			if err := r.Handle(event); err != nil {
+				log.Error("writing session history", "path", r.Path, "err", err)
+			}
+		}
+	}
+}
+
+// Handle updates r from event.
+func (r *Roster) Handle(event Event) error {
+	switch event.Type {
+	case EventPlayerConnected:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.players == nil {
+			r.players = map[string]*Player{}
+		}
+
+		platform, _, _ := strings.Cut(event.PlatformID, "_")
+		r.players[event.PlatformID] = &Player{
+			PlatformID:  event.PlatformID,
+			Platform:    platform,
+			ConnectedAt: event.Time,
+		}
+	case EventPlayerJoined, EventPlayerSpawned:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if player, ok := r.players[event.PlatformID]; ok {
+			player.Name = event.Name
+			player.ZDOID = event.ZDOID
+		}
+	case EventPlayerDisconnected:
+		r.mu.Lock()
+		player, ok := r.players[event.PlatformID]
+		delete(r.players, event.PlatformID)
+		r.mu.Unlock()
+
+		if ok {
+			return r.appendSessions(newSession(player, event.Time))
+		}
+	case EventServerConnected, EventServerStopped, EventServerExited:
+		// The server (re)started or stopped, so nobody can be connected.
+		return r.endAll(event.Time)
+	}
+
+	return nil
+}
+
+func newSession(player *Player, disconnectedAt time.Time) Session {
+	return Session{
+		Player:         *player,
+		DisconnectedAt: disconnectedAt,
+		Duration:       disconnectedAt.Sub(player.ConnectedAt).Round(time.Second).String(),
+	}
+}
+
+func (r *Roster) endAll(t time.Time) error {
+	r.mu.Lock()
+	sessions := []Session{}
+	for _, player := range r.players {
+		sessions = append(sessions, newSession(player, t))
+	}
+	r.players = nil
+	r.mu.Unlock()
+
+	return r.appendSessions(sessions...)
+}
+
+func (r *Roster) appendSessions(sessions ...Session) error {
+	if r.Path == "" || len(sessions) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(r.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+
+	for _, session := range sessions {
+		if err := enc.Encode(session); err != nil {
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+// Players returns the players that are currently
+// connected, in the order that they connected.
+func (r *Roster) Players() []Player {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	players := make([]Player, 0, len(r.players))
+	for _, player := range r.players {
+		players = append(players, *player)
+	}
+
+	slices.SortFunc(players, func(a, b Player) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+
+	return players
+}
+
+// History returns up to limit of the most recent
+// sessions, newest first. If limit is <= 0, every
+// session is returned.
+func (r *Roster) History(limit int) ([]Session, error) {
+	sessions := []Session{}
+
+	if r.Path == "" {
+		return sessions, nil
+	}
+
+	f, err := os.Open(r.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sessions, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		session := Session{}
+		if err := json.Unmarshal(scanner.Bytes(), &session); err != nil {
+			// Skip a line that was only partially
+			// written, e.g. because of a crash.
+			continue
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(sessions)
+
+	if limit > 0 && len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,89 @@
+package valheim_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+func TestRoster(t *testing.T) {
+	var (
+		roster = valheim.NewRoster(t.TempDir())
+		now    = time.Date(2026, 10, 17, 17, 0, 0, 0, time.UTC)
+		events = []valheim.Event{
+			{Type: valheim.EventPlayerConnected, Time: now, PlatformID: "Steam_1"},
+			{Type: valheim.EventPlayerJoined, Time: now, PlatformID: "Steam_1", Name: "Ragnar", ZDOID: &valheim.ZDOID{UserID: 1, ID: 1}},
+			{Type: valheim.EventPlayerConnected, Time: now.Add(time.Minute), PlatformID: "Xbox_2"},
+			{Type: valheim.EventPlayerDisconnected, Time: now.Add(time.Hour), PlatformID: "Steam_1"},
+		}
+	)
+
+	for _, event := range events {
+		if err := roster.Handle(event); err != nil {
+			t.Fatalf("failed to handle event: %v", err)
+		}
+	}
+
+	players := roster.Players()
+	if len(players) != 1 || players[0].PlatformID != "Xbox_2" || players[0].Platform != "Xbox" {
+		t.Fatalf("expected only Xbox_2 to be connected, got %+v", players)
+	}
+
+	// A server restart ends every session.
+	if err := roster.Handle(valheim.Event{Type: valheim.EventServerConnected, Time: now.Add(2 * time.Hour)}); err != nil {
+		t.Fatalf("failed to handle event: %v", err)
+	}
+
+	if players := roster.Players(); len(players) != 0 {
+		t.Fatalf("expected no players to be connected, got %+v", players)
+	}
+
+	sessions, err := roster.History(0)
+	if err != nil {
+		t.Fatalf("failed to read history: %v", err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	if sessions[1].Name != "Ragnar" || sessions[1].Duration != time.Hour.String() {
+		t.Fatalf("expected Ragnar's session to last 1h, got %+v", sessions[1])
+	}
+
+	if sessions, err := roster.History(1); err != nil || len(sessions) != 1 || sessions[0].PlatformID != "Xbox_2" {
+		t.Fatalf("expected only the newest session, got %+v, %v", sessions, err)
+	}
+}
+
+func TestRosterRunUnwritableHistory(t *testing.T) {
+	var (
+		// The history cannot be written to a directory.
+		roster = &valheim.Roster{Path: t.TempDir()}
+		now    = time.Now()
+		events = make(chan valheim.Event)
+		done   = make(chan error)
+	)
+
+	go func() {
+		done <- roster.Run(context.Background(), events)
+	}()
+
+	events <- valheim.Event{Type: valheim.EventPlayerConnected, Time: now, PlatformID: "Steam_1"}
+	events <- valheim.Event{Type: valheim.EventPlayerDisconnected, Time: now, PlatformID: "Steam_1"}
+	events <- valheim.Event{Type: valheim.EventPlayerConnected, Time: now, PlatformID: "Steam_2"}
+	// Once this is received, the previous event has been handled.
+	events <- valheim.Event{Type: valheim.EventPlayerJoined, Time: now, PlatformID: "Steam_2", Name: "Ragnar"}
+
+	if players := roster.Players(); len(players) != 1 || players[0].PlatformID != "Steam_2" {
+		t.Fatalf("expected Run to keep handling events without its history, got %+v", players)
+	}
+
+	close(events)
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected Run to keep going without its history, got %v", err)
+	}
+}
@@ -1,7 +1,6 @@
 package valheim
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -17,34 +16,23 @@ func OpenDB(savedir, world string) (io.ReadCloser, error) {
 }
 
 func ReadWorldSeed(savedir, world string) (string, error) {
-	r, err := OpenFWL(savedir, world)
+	m, err := ReadWorldMetadata(savedir, world)
 	if err != nil {
 		return "", err
 	}
-	defer r.Close()
 
-	return ReadSeed(r, world)
+	return m.SeedName, nil
 }
 
-const (
-	SeedLength = 10
-)
-
 func ReadSeed(r io.Reader, world string) (string, error) {
-	b, err := io.ReadAll(r)
+	m, err := ReadFWL(r)
 	if err != nil {
 		return "", err
 	}
 
-	parts := bytes.Split(b, []byte(world+"\n"))
-	if len(parts) < 2 {
-		return "", fmt.Errorf("unable to parse world %s seed", world)
-	}
-
-	part := parts[1]
-	if len(part) < SeedLength {
+	if m.Name != world {
 		return "", fmt.Errorf("unable to parse world %s seed", world)
 	}
 
-	return string(part[:SeedLength]), nil
+	return m.SeedName, nil
 }
@@ -0,0 +1,502 @@
+package valheim
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/logutil"
+)
+
+// Phase is what the Valheim server is doing.
+type Phase string
+
+const (
+	// PhaseInstalling means that Run has not been
+	// called yet, so the game files are presumably
+	// still being installed.
+	PhaseInstalling Phase = "installing"
+	// PhaseStarting means that the Valheim server
+	// process has been started, but has not yet
+	// finished loading the world.
+	PhaseStarting Phase = "starting"
+	// PhaseRunning means that the Valheim server
+	// has loaded the world.
+	PhaseRunning Phase = "running"
+	// PhaseStopping means that Stop has been called
+	// and the Valheim server process has not yet exited.
+	PhaseStopping Phase = "stopping"
+	// PhaseStopped means that the Valheim server
+	// process exited because of Stop or because
+	// the context passed to Run was done.
+	PhaseStopped Phase = "stopped"
+	// PhaseExited means that the Valheim server
+	// process exited on its own.
+	PhaseExited Phase = "exited"
+	// PhaseRestarting means that the Valheim server
+	// process exited on its own and is waiting to be
+	// restarted according to the Server's RestartPolicy.
+	PhaseRestarting Phase = "restarting"
+	// PhaseCrashLoop means that the Valheim server process
+	// exited on its own too many times too quickly, so it
+	// will not be restarted again until Start is called.
+	PhaseCrashLoop Phase = "crashloop"
+)
+
+// RestartPolicy decides when a Server restarts the
+// Valheim server process after it exits on its own.
+type RestartPolicy struct {
+	// Backoff is how long to wait before restarting. It doubles
+	// for each other restart within Window, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxRestarts is how many times the process may be restarted
+	// within Window before the Server considers it to be crash
+	// looping and stops restarting it.
+	MaxRestarts int
+	Window      time.Duration
+}
+
+var (
+	// DefaultRestartPolicy is a reasonable RestartPolicy.
+	DefaultRestartPolicy = RestartPolicy{
+		Backoff:     5 * time.Second,
+		MaxBackoff:  5 * time.Minute,
+		MaxRestarts: 5,
+		Window:      30 * time.Minute,
+	}
+)
+
+func (p *RestartPolicy) backoff(restarts int) time.Duration {
+	backoff := p.Backoff
+	for range restarts - 1 {
+		if backoff *= 2; p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	return backoff
+}
+
+const (
+	// DefaultShutdownTimeout is how long a Server waits by default
+	// for the Valheim server process to save the world and exit
+	// after being interrupted before killing it.
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+var (
+	// ErrWorldNotSaved is returned when the Valheim server
+	// process exits after being interrupted without saving the world.
+	ErrWorldNotSaved = errors.New("valheim server exited without saving the world")
+)
+
+var (
+	// ReadyLogLine is logged by the Valheim server
+	// once it has loaded the world and connected to Steam.
+	ReadyLogLine = "Game server connected"
+)
+
+// Status describes the state of a Server.
+type Status struct {
+	Phase Phase `json:"phase"`
+	// Live is false if the Valheim server process
+	// exited on its own and will not be restarted.
+	Live bool `json:"live"`
+	// Degraded is true if the Valheim server
+	// process is crash looping.
+	Degraded bool `json:"degraded"`
+	// Ready is true if the Valheim server has
+	// loaded the world and its port is bound.
+	Ready     bool       `json:"ready"`
+	PID       int        `json:"pid,omitempty"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	Uptime    string     `json:"uptime,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	// Restarts is the number of times that the
+	// Valheim server process has been restarted
+	// after exiting on its own.
+	Restarts int `json:"restarts"`
+}
+
+// Server runs the Valheim server in Dir with Opts
+// and allows it to be stopped and started again
+// without returning from Run, e.g. to swap out
+// the world while it is not running.
+type Server struct {
+	Dir            string
+	Opts           *Opts
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+	// Logs, if set, receives every line that the
+	// Valheim server logs to Stdout and Stderr.
+	Logs *LogParser
+	// RestartPolicy, if set, makes Run restart the Valheim server
+	// process when it exits on its own instead of returning.
+	RestartPolicy *RestartPolicy
+	// ShutdownTimeout is how long to wait for the Valheim server
+	// process to save the world and exit after it is interrupted
+	// before killing it. Defaults to DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	exited    chan struct{}
+	stopped   bool
+	start     chan struct{}
+	phase     Phase
+	pid       int
+	startedAt time.Time
+	lastErr   error
+	restarts  int
+	crashes   []time.Time
+	// interrupted is whether the running Valheim server process has
+	// been interrupted and saved is closed once it saves the world after.
+	interrupted bool
+	saved       chan struct{}
+}
+
+func (s *Server) shutdownTimeout() time.Duration {
+	if s.ShutdownTimeout > 0 {
+		return s.ShutdownTimeout
+	}
+
+	return DefaultShutdownTimeout
+}
+
+func (s *Server) onLogLine(line string) {
+	if worldSavedRegexp.MatchString(line) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.interrupted && s.saved != nil {
+			close(s.saved)
+			s.saved = nil
+		}
+	} else if strings.Contains(line, ReadyLogLine) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.phase == PhaseStarting {
+			s.phase = PhaseRunning
+		}
+	}
+}
+
+func (s *Server) port() int64 {
+	if s.Opts != nil && s.Opts.Port != 0 {
+		return s.Opts.Port
+	}
+
+	return DefaultPort
+}
+
+// Status returns the current Status of s.
+func (s *Server) Status() *Status {
+	s.mu.Lock()
+	var (
+		status = &Status{
+			Phase:    s.phase,
+			Live:     s.phase != PhaseExited,
+			Degraded: s.phase == PhaseCrashLoop,
+			PID:      s.pid,
+			Restarts: s.restarts,
+		}
+		startedAt = s.startedAt
+	)
+	if s.lastErr != nil {
+		status.LastError = s.lastErr.Error()
+	}
+	s.mu.Unlock()
+
+	if status.Phase == "" {
+		status.Phase = PhaseInstalling
+	}
+
+	if !startedAt.IsZero() {
+		status.StartedAt = &startedAt
+		status.Uptime = time.Since(startedAt).Round(time.Second).String()
+	}
+
+	status.Ready = status.Phase == PhaseRunning && udpPortBound(s.port())
+
+	return status
+}
+
+// Run runs the Valheim server until ctx is done or it exits
+// on its own. If the server is stopped via Stop, Run waits
+// for Start to be called and then starts it again. If RestartPolicy
+// is set, Run restarts the server when it exits on its own.
+func (s *Server) Run(ctx context.Context) error {
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.phase != PhaseExited {
+			s.phase = PhaseStopped
+		}
+	}()
+
+	log := logutil.SloggerFrom(ctx)
+
+	for {
+		if err := s.waitStart(ctx); err != nil {
+			return err
+		}
+
+		procCtx, cancel := context.WithCancel(ctx)
+
+		cmd, err := NewCommand(procCtx, s.Dir, s.Opts)
+		if err != nil {
+			cancel()
+			s.mu.Lock()
+			s.phase = PhaseExited
+			s.lastErr = err
+			s.mu.Unlock()
+			return err
+		}
+
+		onLogLine := func(line string) {
+			s.onLogLine(line)
+
+			if s.Logs != nil {
+				s.Logs.Handle(ctx, line)
+			}
+		}
+
+		var (
+			interrupt = cmd.Cancel
+			saved     = make(chan struct{})
+		)
+
+		// Give the Valheim server process a chance to save the
+		// world after it is interrupted before it gets killed.
+		cmd.WaitDelay = s.shutdownTimeout()
+		cmd.Cancel = func() error {
+			s.mu.Lock()
+			s.interrupted = true
+			s.mu.Unlock()
+
+			log.Info("waiting for valheim server to save the world", "timeout", cmd.WaitDelay)
+			return interrupt()
+		}
+
+		cmd.Stdin = s.Stdin
+		cmd.Stdout = newLineWriter(s.Stdout, onLogLine)
+		cmd.Stderr = newLineWriter(s.Stderr, onLogLine)
+
+		exited := make(chan struct{})
+
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			cancel()
+			continue
+		}
+		s.cancel = cancel
+		s.exited = exited
+		s.interrupted = false
+		s.saved = saved
+		s.phase = PhaseStarting
+		s.mu.Unlock()
+
+		if err = cmd.Start(); err == nil {
+			s.mu.Lock()
+			s.pid = cmd.Process.Pid
+			s.startedAt = time.Now()
+			s.mu.Unlock()
+
+			err = cmd.Wait()
+		}
+		cancel()
+		close(exited)
+
+		event := &Event{Type: EventServerStopped, Time: time.Now()}
+
+		s.mu.Lock()
+		var notSaved error
+		if s.interrupted {
+			select {
+			case <-saved:
+				log.Info("valheim server saved the world")
+			default:
+				notSaved = ErrWorldNotSaved
+				log.Error("valheim server exited without saving the world", "err", err)
+			}
+		}
+		s.cancel = nil
+		s.interrupted = false
+		s.saved = nil
+		s.pid = 0
+		s.startedAt = time.Time{}
+		stopped := s.stopped
+		if stopped || ctx.Err() != nil {
+			s.phase = PhaseStopped
+		} else {
+			s.phase = PhaseExited
+			s.lastErr = err
+			if s.lastErr == nil {
+				s.lastErr = errors.New("valheim server exited unexpectedly")
+			}
+
+			event.Type = EventServerExited
+			event.Error = s.lastErr.Error()
+		}
+		s.mu.Unlock()
+
+		if s.Logs != nil {
+			s.Logs.publish(ctx, event)
+		}
+
+		if ctx.Err() != nil {
+			if notSaved != nil {
+				return errors.Join(notSaved, ctx.Err())
+			}
+
+			return ctx.Err()
+		} else if stopped {
+			continue
+		} else if s.RestartPolicy == nil {
+			return err
+		}
+
+		backoff, crashLoop := s.crashed(time.Now())
+		if crashLoop {
+			log.Error("valheim server is crash looping: not restarting it until it is started manually", "err", err)
+			continue
+		}
+
+		log.Warn("restarting valheim server", "err", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// crashed records that the Valheim server process exited on its own
+// at the given time. It returns how long to wait before restarting it,
+// or true if it is crash looping, in which case it puts s into PhaseCrashLoop.
+func (s *Server) crashed(t time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	crashes := []time.Time{}
+	for _, crash := range s.crashes {
+		if t.Sub(crash) < s.RestartPolicy.Window {
+			crashes = append(crashes, crash)
+		}
+	}
+	s.crashes = append(crashes, t)
+
+	if len(s.crashes) > s.RestartPolicy.MaxRestarts {
+		s.phase = PhaseCrashLoop
+		s.stopped = true
+		s.start = make(chan struct{})
+		return 0, true
+	}
+
+	s.restarts++
+	s.phase = PhaseRestarting
+
+	return s.RestartPolicy.backoff(len(s.crashes)), false
+}
+
+func (s *Server) waitStart(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	start := s.start
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-start:
+		return nil
+	}
+}
+
+// Stop stops the Valheim server, if it is running, and waits for it to
+// save the world and exit, which it is killed after ShutdownTimeout to.
+// If it exits without saving the world, Stop returns ErrWorldNotSaved.
+// It is not started again until Start is called.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	s.start = make(chan struct{})
+	cancel, exited, saved := s.cancel, s.exited, s.saved
+	if cancel != nil {
+		s.phase = PhaseStopping
+	} else if s.phase == PhaseRestarting {
+		s.phase = PhaseStopped
+	}
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+
+	timer := time.NewTimer(s.shutdownTimeout())
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-saved:
+	case <-exited:
+	case <-timer.C:
+	}
+
+	// Even once the world is saved, it must not be touched until
+	// the process exits, which it is killed by now at the latest.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-exited:
+	}
+
+	select {
+	case <-saved:
+		return nil
+	default:
+		return ErrWorldNotSaved
+	}
+}
+
+// Start starts the Valheim server again after Stop
+// or after it was found to be crash looping.
+func (s *Server) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		s.stopped = false
+		s.crashes = nil
+		close(s.start)
+	}
+}
+
+// Restart stops the Valheim server, if it is
+// running, and then starts it again, even if
+// it did not save the world when it stopped.
+func (s *Server) Restart(ctx context.Context) error {
+	err := s.Stop(ctx)
+
+	s.Start()
+
+	return err
+}
@@ -0,0 +1,246 @@
+package valheim_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+func TestServerCrashLoop(t *testing.T) {
+	dir := t.TempDir()
+
+	// A "Valheim server" that crashes immediately.
+	if err := os.WriteFile(filepath.Join(dir, "valheim_server.x86_64"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake Valheim server: %v", err)
+	}
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		server      = &valheim.Server{
+			Dir:  dir,
+			Opts: &valheim.Opts{World: "valheimw", Password: "hunter2"},
+			RestartPolicy: &valheim.RestartPolicy{
+				Backoff:     time.Millisecond,
+				MaxRestarts: 2,
+				Window:      time.Minute,
+			},
+		}
+		errC = make(chan error, 1)
+	)
+	defer cancel()
+
+	go func() {
+		errC <- server.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for server.Status().Phase != valheim.PhaseCrashLoop {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for crash loop, status: %+v", server.Status())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := server.Status()
+	if status.Restarts != 2 {
+		t.Fatalf("expected 2 restarts, got %d", status.Restarts)
+	}
+
+	if !status.Live || !status.Degraded || status.Ready {
+		t.Fatalf("expected live, degraded and unready, got %+v", status)
+	}
+
+	if status.LastError == "" {
+		t.Fatal("expected last error")
+	}
+
+	cancel()
+
+	if err := <-errC; err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestServerShutdownSavesWorld(t *testing.T) {
+	dir := t.TempDir()
+
+	// A "Valheim server" that saves the world when it is interrupted.
+	if err := os.WriteFile(filepath.Join(dir, "valheim_server.x86_64"), []byte(`#!/bin/sh
+trap 'echo "10/17/2026 17:00:00: World saved ( 1.5ms )"; exit 0' INT
+echo "10/17/2026 17:00:00: Game server connected"
+while :; do sleep 0.1; done
+`), 0755); err != nil {
+		t.Fatalf("failed to write fake Valheim server: %v", err)
+	}
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		logs        = &valheim.LogParser{}
+		server      = &valheim.Server{
+			Dir:             dir,
+			Opts:            &valheim.Opts{World: "valheimw", Password: "hunter2"},
+			Logs:            logs,
+			ShutdownTimeout: 10 * time.Second,
+		}
+		subCtx, unsubscribe = context.WithCancel(context.Background())
+		events              = logs.Subscribe(subCtx, 8)
+		errC                = make(chan error, 1)
+	)
+	defer cancel()
+	defer unsubscribe()
+
+	go func() {
+		errC <- server.Run(ctx)
+	}()
+
+	for event := range events {
+		if event.Type == valheim.EventServerConnected {
+			break
+		}
+	}
+
+	start := time.Now()
+	cancel()
+
+	if err := <-errC; err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if elapsed := time.Since(start); elapsed >= server.ShutdownTimeout {
+		t.Fatalf("expected Valheim server to exit before the shutdown timeout, took %s", elapsed)
+	}
+
+	unsubscribe()
+
+	saved := false
+	for event := range events {
+		if event.Type == valheim.EventWorldSaved {
+			saved = true
+		}
+	}
+
+	if !saved {
+		t.Fatal("expected world to be saved")
+	}
+}
+
+func TestServerStop(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		script string
+		err    error
+	}{
+		{
+			name: "saved",
+			script: `#!/bin/sh
+trap 'echo "10/17/2026 17:00:00: World saved ( 1.5ms )"; exit 0' INT
+echo "10/17/2026 17:00:00: Game server connected"
+while :; do sleep 0.1; done
+`,
+		},
+		{
+			name: "not saved",
+			script: `#!/bin/sh
+trap 'exit 0' INT
+echo "10/17/2026 17:00:00: Game server connected"
+while :; do sleep 0.1; done
+`,
+			err: valheim.ErrWorldNotSaved,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			if err := os.WriteFile(filepath.Join(dir, "valheim_server.x86_64"), []byte(tc.script), 0755); err != nil {
+				t.Fatalf("failed to write fake Valheim server: %v", err)
+			}
+
+			var (
+				ctx, cancel = context.WithCancel(context.Background())
+				server      = &valheim.Server{
+					Dir:             dir,
+					Opts:            &valheim.Opts{World: "valheimw", Password: "hunter2"},
+					ShutdownTimeout: 10 * time.Second,
+				}
+				errC = make(chan error, 1)
+			)
+			defer cancel()
+
+			go func() {
+				errC <- server.Run(ctx)
+			}()
+
+			deadline := time.Now().Add(10 * time.Second)
+			for server.Status().Phase != valheim.PhaseRunning {
+				if time.Now().After(deadline) {
+					t.Fatalf("timed out waiting for Valheim server to run, status: %+v", server.Status())
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if err := server.Stop(ctx); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+
+			if phase := server.Status().Phase; phase != valheim.PhaseStopped {
+				t.Fatalf("expected %s, got %s", valheim.PhaseStopped, phase)
+			}
+
+			cancel()
+
+			if err := <-errC; err != context.Canceled {
+				t.Fatalf("expected %v, got %v", context.Canceled, err)
+			}
+		})
+	}
+}
+
+func TestServerShutdownWithoutSaving(t *testing.T) {
+	dir := t.TempDir()
+
+	// A "Valheim server" that exits without saving the world when it is interrupted.
+	if err := os.WriteFile(filepath.Join(dir, "valheim_server.x86_64"), []byte(`#!/bin/sh
+trap 'exit 0' INT
+echo "10/17/2026 17:00:00: Game server connected"
+while :; do sleep 0.1; done
+`), 0755); err != nil {
+		t.Fatalf("failed to write fake Valheim server: %v", err)
+	}
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		server      = &valheim.Server{
+			Dir:             dir,
+			Opts:            &valheim.Opts{World: "valheimw", Password: "hunter2"},
+			ShutdownTimeout: 10 * time.Second,
+		}
+		errC = make(chan error, 1)
+	)
+	defer cancel()
+
+	go func() {
+		errC <- server.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for server.Status().Phase != valheim.PhaseRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for Valheim server to run, status: %+v", server.Status())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-errC; !errors.Is(err, valheim.ErrWorldNotSaved) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v and %v, got %v", valheim.ErrWorldNotSaved, context.Canceled, err)
+	}
+}
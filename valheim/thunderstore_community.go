@@ -0,0 +1,7 @@
+package valheim
+
+const (
+	// ThunderstoreCommunity is Valheim's Thunderstore
+	// community identifier, as in thunderstore.io/c/valheim.
+	ThunderstoreCommunity = "valheim"
+)
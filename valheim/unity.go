@@ -0,0 +1,150 @@
+package valheim
+
+import "math"
+
+// unityRandom is a port of UnityEngine.Random,
+// a xorshift128 generator.
+type unityRandom struct {
+	x, y, z, w uint32
+}
+
+func newUnityRandom(seed int32) *unityRandom {
+	r := &unityRandom{x: uint32(seed)}
+	r.y = r.x*1812433253 + 1
+	r.z = r.y*1812433253 + 1
+	r.w = r.z*1812433253 + 1
+	return r
+}
+
+func (r *unityRandom) next() uint32 {
+	t := r.x ^ (r.x << 11)
+	r.x, r.y, r.z = r.y, r.z, r.w
+	r.w = (r.w ^ (r.w >> 19)) ^ (t ^ (t >> 8))
+	return r.w
+}
+
+// rangeInt is a port of UnityEngine.Random.Range(int, int).
+func (r *unityRandom) rangeInt(lo, hi int32) int32 {
+	switch {
+	case lo < hi:
+		return int32(uint32(lo) + r.next()%(uint32(hi)-uint32(lo)))
+	case lo > hi:
+		return int32(uint32(lo) - r.next()%(uint32(lo)-uint32(hi)))
+	}
+
+	return lo
+}
+
+// perlinPermutation is Ken Perlin's reference permutation.
+var perlinPermutation = func() [512]int {
+	p := [256]int{
+		151, 160, 137, 91, 90, 15, 131, 13, 201, 95, 96, 53, 194, 233, 7, 225,
+		140, 36, 103, 30, 69, 142, 8, 99, 37, 240, 21, 10, 23, 190, 6, 148,
+		247, 120, 234, 75, 0, 26, 197, 62, 94, 252, 219, 203, 117, 35, 11, 32,
+		57, 177, 33, 88, 237, 149, 56, 87, 174, 20, 125, 136, 171, 168, 68, 175,
+		74, 165, 71, 134, 139, 48, 27, 166, 77, 146, 158, 231, 83, 111, 229, 122,
+		60, 211, 133, 230, 220, 105, 92, 41, 55, 46, 245, 40, 244, 102, 143, 54,
+		65, 25, 63, 161, 1, 216, 80, 73, 209, 76, 132, 187, 208, 89, 18, 169,
+		200, 196, 135, 130, 116, 188, 159, 86, 164, 100, 109, 198, 173, 186, 3, 64,
+		52, 217, 226, 250, 124, 123, 5, 202, 38, 147, 118, 126, 255, 82, 85, 212,
+		207, 206, 59, 227, 47, 16, 58, 17, 182, 189, 28, 42, 223, 183, 170, 213,
+		119, 248, 152, 2, 44, 154, 163, 70, 221, 153, 101, 155, 167, 43, 172, 9,
+		129, 22, 39, 253, 19, 98, 108, 110, 79, 113, 224, 232, 178, 185, 112, 104,
+		218, 246, 97, 228, 251, 34, 242, 193, 238, 210, 144, 12, 191, 179, 162, 241,
+		81, 51, 145, 235, 249, 14, 239, 107, 49, 192, 214, 31, 181, 199, 106, 157,
+		184, 84, 204, 176, 115, 121, 50, 45, 127, 4, 150, 254, 138, 236, 205, 93,
+		222, 114, 67, 29, 24, 72, 243, 141, 128, 195, 78, 66, 215, 61, 156, 180,
+	}
+
+	var pp [512]int
+	for i := range pp {
+		pp[i] = p[i%256]
+	}
+
+	return pp
+}()
+
+func perlinFade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func perlinLerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+func perlinGrad(hash int, x, y float64) float64 {
+	h := hash & 15
+
+	u := y
+	if h < 8 {
+		u = x
+	}
+
+	v := 0.0
+	switch {
+	case h < 4:
+		v = y
+	case h == 12 || h == 14:
+		v = x
+	}
+
+	if h&1 != 0 {
+		u = -u
+	}
+
+	if h&2 != 0 {
+		v = -v
+	}
+
+	return u + v
+}
+
+// perlinNoise is a port of UnityEngine.Mathf.PerlinNoise,
+// 2D improved Perlin noise normalized to roughly [0, 1].
+func perlinNoise(x, y float64) float64 {
+	var (
+		fx = math.Floor(x)
+		fy = math.Floor(y)
+		xi = int(fx) & 255
+		yi = int(fy) & 255
+	)
+
+	x -= fx
+	y -= fy
+
+	var (
+		p  = &perlinPermutation
+		u  = perlinFade(x)
+		v  = perlinFade(y)
+		a  = p[xi] + yi
+		aa = p[a]
+		ab = p[a+1]
+		b  = p[xi+1] + yi
+		ba = p[b]
+		bb = p[b+1]
+		n  = perlinLerp(v,
+			perlinLerp(u, perlinGrad(p[aa], x, y), perlinGrad(p[ba], x-1, y)),
+			perlinLerp(u, perlinGrad(p[ab], x, y-1), perlinGrad(p[bb], x-1, y-1)),
+		)
+	)
+
+	return (n + 0.69) / (0.793 + 0.69)
+}
+
+func clamp01(v float64) float64 {
+	return math.Min(math.Max(v, 0), 1)
+}
+
+// lerp is a port of UnityEngine.Mathf.Lerp, which clamps t.
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*clamp01(t)
+}
+
+func lerpStep(l, h, v float64) float64 {
+	return clamp01((v - l) / (h - l))
+}
+
+func smoothStep(lo, hi, v float64) float64 {
+	t := clamp01((v - lo) / (hi - lo))
+	return t * t * (3 - 2*t)
+}
@@ -0,0 +1,211 @@
+package valheim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/frantjc/valheimw/internal/logutil"
+)
+
+const (
+	// DefaultUpdateInterval is how often an Updater
+	// checks for a new build of the Valheim server by default.
+	DefaultUpdateInterval = time.Hour
+	// DefaultUpdateMaxDelay is how long an Updater waits by
+	// default for players to leave before updating anyways.
+	DefaultUpdateMaxDelay = time.Hour
+)
+
+var (
+	// pendingUpdateInterval is how often an Updater checks if
+	// players have left while it is waiting to apply an update.
+	pendingUpdateInterval = 30 * time.Second
+)
+
+// Version describes the build of the Valheim server that
+// is installed and the latest build that is available.
+type Version struct {
+	BuildID          int        `json:"buildId,omitempty"`
+	AvailableBuildID int        `json:"availableBuildId,omitempty"`
+	UpdateAvailable  bool       `json:"updateAvailable"`
+	CheckedAt        *time.Time `json:"checkedAt,omitempty"`
+	// UpdateBy is when the available update will be
+	// applied even if players are still connected.
+	UpdateBy *time.Time `json:"updateBy,omitempty"`
+}
+
+// Updater checks for new builds of the Valheim server and, when one
+// is available, waits for players to leave before stopping Server,
+// updating it and starting it again.
+type Updater struct {
+	Server *Server
+	// Roster, if set, is used to wait for
+	// players to leave before updating.
+	Roster *Roster
+	// Installed returns the ID of the installed build.
+	Installed func() (int, error)
+	// Latest returns the ID of the latest available build.
+	Latest func(context.Context) (int, error)
+	// Update installs the latest build while Server is stopped.
+	Update func(context.Context) error
+	// OnUpdateAvailable, if set, is called once
+	// for each new build that becomes available.
+	OnUpdateAvailable func(buildID int)
+	Interval          time.Duration
+	// MaxDelay is the longest to wait for players
+	// to leave before updating while they are connected.
+	MaxDelay time.Duration
+
+	mu        sync.Mutex
+	available int
+	checkedAt time.Time
+	updateBy  time.Time
+	notified  int
+}
+
+func (u *Updater) interval() time.Duration {
+	if u.Interval > 0 {
+		return u.Interval
+	}
+
+	return DefaultUpdateInterval
+}
+
+func (u *Updater) maxDelay() time.Duration {
+	if u.MaxDelay > 0 {
+		return u.MaxDelay
+	}
+
+	return DefaultUpdateMaxDelay
+}
+
+// Version returns the current Version.
+func (u *Updater) Version() *Version {
+	version := &Version{}
+
+	if u.Installed != nil {
+		version.BuildID, _ = u.Installed()
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	version.AvailableBuildID = u.available
+	version.UpdateAvailable = version.BuildID > 0 && u.available > version.BuildID
+
+	if !u.checkedAt.IsZero() {
+		checkedAt := u.checkedAt
+		version.CheckedAt = &checkedAt
+	}
+
+	if !u.updateBy.IsZero() {
+		updateBy := u.updateBy
+		version.UpdateBy = &updateBy
+	}
+
+	return version
+}
+
+// Run checks for updates every Interval, or more often while
+// waiting for players to leave, until ctx is done.
+func (u *Updater) Run(ctx context.Context) error {
+	log := logutil.SloggerFrom(ctx)
+
+	for {
+		interval := u.interval()
+
+		u.mu.Lock()
+		if !u.updateBy.IsZero() {
+			interval = min(interval, pendingUpdateInterval)
+		}
+		u.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		if err := u.Check(ctx); err != nil {
+			log.Error("checking for valheim server update", "err", err)
+		}
+	}
+}
+
+// Check checks for a new build of the Valheim server and
+// applies it if nobody is connected or MaxDelay has passed
+// since it was first found.
+func (u *Updater) Check(ctx context.Context) error {
+	log := logutil.SloggerFrom(ctx)
+
+	current, err := u.Installed()
+	if errors.Is(err, os.ErrNotExist) {
+		// The Valheim server has not been installed yet.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("getting installed build ID: %w", err)
+	}
+
+	latest, err := u.Latest(ctx)
+	if err != nil {
+		return fmt.Errorf("getting latest build ID: %w", err)
+	}
+
+	now := time.Now()
+
+	u.mu.Lock()
+	u.available = latest
+	u.checkedAt = now
+	if latest <= current {
+		u.updateBy = time.Time{}
+		u.mu.Unlock()
+		return nil
+	}
+	if u.updateBy.IsZero() {
+		u.updateBy = now.Add(u.maxDelay())
+	}
+	updateBy := u.updateBy
+	notify := u.notified != latest
+	u.notified = latest
+	u.mu.Unlock()
+
+	if notify {
+		log.Info("valheim server update available", "buildId", current, "availableBuildId", latest, "updateBy", updateBy)
+
+		if u.OnUpdateAvailable != nil {
+			u.OnUpdateAvailable(latest)
+		}
+	}
+
+	if u.Roster != nil && now.Before(updateBy) {
+		if players := len(u.Roster.Players()); players > 0 {
+			// Valheim has no RCON or console to warn players
+			// in-game with, so count down in the logs instead.
+			log.Info("waiting for players to leave before updating valheim server", "players", players, "in", updateBy.Sub(now).Round(time.Second))
+			return nil
+		}
+	}
+
+	log.Info("updating valheim server", "buildId", current, "availableBuildId", latest)
+
+	if err := u.Server.Stop(ctx); err != nil {
+		return fmt.Errorf("stopping valheim server to update it: %w", err)
+	}
+	defer u.Server.Start()
+
+	if err := u.Update(ctx); err != nil {
+		return fmt.Errorf("updating valheim server: %w", err)
+	}
+
+	u.mu.Lock()
+	u.updateBy = time.Time{}
+	u.mu.Unlock()
+
+	log.Info("updated valheim server", "buildId", latest)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package valheim_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+func TestUpdaterWaitsForPlayersToLeave(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		current  = 1
+		notified = []int{}
+		roster   = &valheim.Roster{}
+		updater  = &valheim.Updater{
+			Server: &valheim.Server{},
+			Roster: roster,
+			Installed: func() (int, error) {
+				return current, nil
+			},
+			Latest: func(context.Context) (int, error) {
+				return 2, nil
+			},
+			Update: func(context.Context) error {
+				current = 2
+				return nil
+			},
+			OnUpdateAvailable: func(buildID int) {
+				notified = append(notified, buildID)
+			},
+			MaxDelay: time.Hour,
+		}
+	)
+
+	if err := roster.Handle(valheim.Event{Type: valheim.EventPlayerConnected, PlatformID: "Steam_76561198000000001", Time: time.Now()}); err != nil {
+		t.Fatalf("failed to handle event: %v", err)
+	}
+
+	for range 2 {
+		if err := updater.Check(ctx); err != nil {
+			t.Fatalf("failed to check for update: %v", err)
+		}
+	}
+
+	if current != 1 {
+		t.Fatal("expected update to wait for players to leave")
+	}
+
+	if len(notified) != 1 || notified[0] != 2 {
+		t.Fatalf("expected to be notified of build 2 once, got %v", notified)
+	}
+
+	if version := updater.Version(); !version.UpdateAvailable || version.UpdateBy == nil {
+		t.Fatalf("expected pending update, got %+v", version)
+	}
+
+	if err := roster.Handle(valheim.Event{Type: valheim.EventPlayerDisconnected, PlatformID: "Steam_76561198000000001", Time: time.Now()}); err != nil {
+		t.Fatalf("failed to handle event: %v", err)
+	}
+
+	if err := updater.Check(ctx); err != nil {
+		t.Fatalf("failed to check for update: %v", err)
+	}
+
+	if current != 2 {
+		t.Fatal("expected update once players left")
+	}
+
+	if version := updater.Version(); version.UpdateAvailable || version.UpdateBy != nil || version.BuildID != 2 {
+		t.Fatalf("expected no pending update, got %+v", version)
+	}
+}
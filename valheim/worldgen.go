@@ -0,0 +1,178 @@
+package valheim
+
+import "math"
+
+// Biome is a Valheim biome. The values match
+// Valheim's Heightmap.Biome flags.
+type Biome int
+
+const (
+	BiomeNone        Biome = 0
+	BiomeMeadows     Biome = 1
+	BiomeSwamp       Biome = 2
+	BiomeMountain    Biome = 4
+	BiomeBlackForest Biome = 8
+	BiomePlains      Biome = 16
+	BiomeAshLands    Biome = 32
+	BiomeDeepNorth   Biome = 64
+	BiomeOcean       Biome = 256
+	BiomeMistlands   Biome = 512
+)
+
+func (b Biome) String() string {
+	switch b {
+	case BiomeMeadows:
+		return "Meadows"
+	case BiomeSwamp:
+		return "Swamp"
+	case BiomeMountain:
+		return "Mountain"
+	case BiomeBlackForest:
+		return "BlackForest"
+	case BiomePlains:
+		return "Plains"
+	case BiomeAshLands:
+		return "AshLands"
+	case BiomeDeepNorth:
+		return "DeepNorth"
+	case BiomeOcean:
+		return "Ocean"
+	case BiomeMistlands:
+		return "Mistlands"
+	}
+
+	return "None"
+}
+
+const (
+	// WorldRadius is the distance from the center of
+	// the world to its edge.
+	WorldRadius = 10500
+)
+
+// WorldGenerator is a port of the parts of Valheim's WorldGenerator
+// that decide the base height and biome of a given point in the world.
+// Rivers, streams and lakes are not generated, so heights are approximate,
+// but biomes match those of the game.
+type WorldGenerator struct {
+	offset0, offset1, offset2, offset3, offset4 float64
+
+	minMountainDistance float64
+	maxMarshDistance    float64
+	minDarklandNoise    float64
+}
+
+// NewWorldGenerator returns a WorldGenerator for the world
+// described by the given WorldMetadata.
+func NewWorldGenerator(m *WorldMetadata) *WorldGenerator {
+	g := &WorldGenerator{
+		minMountainDistance: 1000,
+		maxMarshDistance:    6000,
+		minDarklandNoise:    0.4,
+	}
+
+	if m.WorldGenVersion <= 0 {
+		g.minMountainDistance = 1500
+	}
+
+	if m.WorldGenVersion <= 1 {
+		g.maxMarshDistance = 8000
+		g.minDarklandNoise = 0.5
+	}
+
+	r := newUnityRandom(m.SeedHash)
+
+	g.offset0 = float64(r.rangeInt(-10000, 10000))
+	g.offset1 = float64(r.rangeInt(-10000, 10000))
+	g.offset2 = float64(r.rangeInt(-10000, 10000))
+	g.offset3 = float64(r.rangeInt(-10000, 10000))
+	// The river and stream seeds.
+	_ = r.rangeInt(math.MinInt32, math.MaxInt32)
+	_ = r.rangeInt(math.MinInt32, math.MaxInt32)
+	g.offset4 = float64(r.rangeInt(-10000, 10000))
+
+	return g
+}
+
+func worldAngle(x, z float64) float64 {
+	return math.Sin(math.Atan2(x, z) * 20)
+}
+
+// Biome returns the biome at the given world coordinates.
+func (g *WorldGenerator) Biome(x, z float64) Biome {
+	var (
+		magnitude  = math.Hypot(x, z)
+		baseHeight = g.BaseHeight(x, z)
+		angle      = worldAngle(x, z) * 100
+	)
+
+	switch {
+	case math.Hypot(x, z-4000) > 12000+angle:
+		return BiomeAshLands
+	case baseHeight <= 0.02:
+		return BiomeOcean
+	case math.Hypot(x, z+4000) > 12000+angle:
+		if baseHeight > 0.4 {
+			return BiomeMountain
+		}
+
+		return BiomeDeepNorth
+	case baseHeight > 0.4:
+		return BiomeMountain
+	case perlinNoise((g.offset0+x)*0.001, (g.offset0+z)*0.001) > 0.6 &&
+		magnitude > 2000 && magnitude < g.maxMarshDistance &&
+		baseHeight > 0.05 && baseHeight < 0.25:
+		return BiomeSwamp
+	case perlinNoise((g.offset4+x)*0.001, (g.offset4+z)*0.001) > g.minDarklandNoise &&
+		magnitude > 6000+angle && magnitude < 10000:
+		return BiomeMistlands
+	case perlinNoise((g.offset1+x)*0.001, (g.offset1+z)*0.001) > 0.4 &&
+		magnitude > 3000+angle && magnitude < 8000:
+		return BiomePlains
+	case perlinNoise((g.offset2+x)*0.001, (g.offset2+z)*0.001) > 0.4 &&
+		magnitude > 600+angle && magnitude < 6000:
+		return BiomeBlackForest
+	case magnitude > 5000+angle:
+		return BiomeBlackForest
+	}
+
+	return BiomeMeadows
+}
+
+// BaseHeight returns the height of the terrain at the given world
+// coordinates before rivers and biome-specific detail are applied.
+// Values above 0.02 are above sea level.
+func (g *WorldGenerator) BaseHeight(x, z float64) float64 {
+	magnitude := math.Hypot(x, z)
+
+	x += 100000 + g.offset0
+	z += 100000 + g.offset1
+
+	h := perlinNoise(x*0.002*0.5, z*0.002*0.5) * perlinNoise(x*0.003*0.5, z*0.003*0.5)
+	h += perlinNoise(x*0.002, z*0.002) * perlinNoise(x*0.003, z*0.003) * h * 0.9
+	h += perlinNoise(x*0.005, z*0.005) * perlinNoise(x*0.01, z*0.01) * 0.5 * h
+	h -= 0.07
+
+	var (
+		n0    = perlinNoise(x*0.002*0.25+0.123, z*0.002*0.25+0.15123)
+		n1    = perlinNoise(x*0.002*0.25+0.321, z*0.002*0.25+0.231)
+		ridge = (1 - lerpStep(0.02, 0.12, math.Abs(n0-n1))) * smoothStep(744, 1000, magnitude)
+	)
+
+	h *= 1 - ridge
+
+	if magnitude > 10000 {
+		h = lerp(h, -0.2, lerpStep(10000, WorldRadius, magnitude))
+
+		if edge := 10490.0; magnitude > edge {
+			h = lerp(h, -2, lerpStep(edge, WorldRadius, magnitude))
+		}
+	}
+
+	if magnitude < g.minMountainDistance && h > 0.28 {
+		t := clamp01((h - 0.28) / 0.099999994)
+		h = lerp(lerp(0.28, 0.38, t), h, lerpStep(g.minMountainDistance-400, g.minMountainDistance, magnitude))
+	}
+
+	return h
+}
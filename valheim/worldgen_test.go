@@ -0,0 +1,76 @@
+package valheim_test
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/frantjc/valheimw/valheim"
+)
+
+func TestUnityRandom(t *testing.T) {
+	for _, tc := range []struct {
+		seed     int32
+		expected []int32
+	}{
+		{12345, []int32{-1284, -2244, 5199, 9970, -5411}},
+		{valheim.StableHashCode("HHcLC5acQt"), []int32{-2374, -2373, -3944, 5323, -9687}},
+	} {
+		if actual := valheim.UnityRandomRange(tc.seed, -10000, 10000, len(tc.expected)); !slices.Equal(tc.expected, actual) {
+			t.Fatalf("expected seed %d to produce %v, got %v", tc.seed, tc.expected, actual)
+		}
+	}
+}
+
+func TestPerlinNoise(t *testing.T) {
+	for _, tc := range []struct {
+		x, y     float64
+		expected float64
+	}{
+		// Unity's Mathf.PerlinNoise is 0.4652731 at every integer coordinate.
+		{0, 0, 0.4652731},
+		{-7, 12, 0.4652731},
+		{0.5, 0.5, 0.2966959},
+		{1.25, 3.75, 0.3243711},
+		{-7.3, 12.9, 0.6076223},
+		{123.456, -78.9, 0.5259787},
+	} {
+		if actual := valheim.PerlinNoise(tc.x, tc.y); math.Abs(actual-tc.expected) > 1e-6 {
+			t.Fatalf("expected noise at (%v, %v) to be %v, got %v", tc.x, tc.y, tc.expected, actual)
+		}
+	}
+}
+
+func TestWorldGeneratorBiome(t *testing.T) {
+	var (
+		seedName = "HHcLC5acQt"
+		g        = valheim.NewWorldGenerator(&valheim.WorldMetadata{
+			SeedName:        seedName,
+			SeedHash:        valheim.StableHashCode(seedName),
+			WorldGenVersion: 2,
+		})
+	)
+
+	for _, tc := range []struct {
+		x, z     float64
+		expected valheim.Biome
+	}{
+		{0, -10000, valheim.BiomeAshLands},
+		{0, 9000, valheim.BiomeDeepNorth},
+		{-2500, 4000, valheim.BiomeMountain},
+		{-1500, -800, valheim.BiomeMeadows},
+		{3000, 3000, valheim.BiomeBlackForest},
+		{2200, 500, valheim.BiomeBlackForest},
+		{-7500, 1500, valheim.BiomePlains},
+		{-7000, -2000, valheim.BiomePlains},
+		{-5500, -500, valheim.BiomeSwamp},
+		{6500, -2500, valheim.BiomeMistlands},
+		{-8000, 3000, valheim.BiomeMistlands},
+		{-4500, 1200, valheim.BiomeOcean},
+		{0, 0, valheim.BiomeOcean},
+	} {
+		if actual := g.Biome(tc.x, tc.z); actual != tc.expected {
+			t.Fatalf("expected biome at (%v, %v) to be %s, got %s", tc.x, tc.z, tc.expected, actual)
+		}
+	}
+}